@@ -0,0 +1,239 @@
+package fixedwidth
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+)
+
+// Charset is a single byte character set text fields are transcoded to and
+// from, ISO-8859-1 or an EBCDIC code page. The EBCDIC code pages hold the
+// same 256 characters as ISO-8859-1 in a different order, so transcoding goes
+// through ISO-8859-1 and any character outside of it is an error
+type Charset struct {
+	Name string
+	// the ISO-8859-1 character of every byte of the charset and its inverse
+	toLatin1   [256]byte
+	fromLatin1 [256]byte
+}
+
+// the built in charsets, named like the values of the charset tag
+var (
+	CharsetLatin1 = newCharset("latin1", identityTable())
+	CharsetCP037  = newCharset("cp037", cp037Table)
+	CharsetCP1047 = newCharset("cp1047", cp1047Table())
+)
+
+// charsets maps the values of the charset tag to charsets, utf8 turns
+// transcoding off for a field
+var charsets = map[string]*Charset{
+	"latin1":     CharsetLatin1,
+	"iso-8859-1": CharsetLatin1,
+	"cp037":      CharsetCP037,
+	"cp1047":     CharsetCP1047,
+	"utf8":       nil,
+	"utf-8":      nil,
+}
+
+func newCharset(name string, toLatin1 [256]byte) *Charset {
+	c := &Charset{Name: name, toLatin1: toLatin1}
+	for b, l := range toLatin1 {
+		c.fromLatin1[l] = byte(b)
+	}
+	return c
+}
+
+// Encode transcodes UTF-8 text to the charset
+func (c *Charset) Encode(s string) (b []byte, err error) {
+	var l string
+	if l, err = toLatin1(s); err != nil {
+		return
+	}
+	b = []byte(l)
+	c.encodeLatin1(b)
+	return
+}
+
+// Decode transcodes text in the charset to UTF-8
+func (c *Charset) Decode(b []byte) string {
+	l := make([]byte, len(b))
+	copy(l, b)
+	c.decodeLatin1(l)
+	return fromLatin1(l)
+}
+
+// encodeLatin1 maps ISO-8859-1 bytes to the charset in place
+func (c *Charset) encodeLatin1(b []byte) {
+	for i, x := range b {
+		b[i] = c.fromLatin1[x]
+	}
+}
+
+// decodeLatin1 maps bytes of the charset to ISO-8859-1 in place
+func (c *Charset) decodeLatin1(b []byte) {
+	for i, x := range b {
+		b[i] = c.toLatin1[x]
+	}
+}
+
+// toLatin1 converts UTF-8 text to a string of ISO-8859-1 bytes, one byte per
+// character so it is padded and cut like ASCII
+func toLatin1(s string) (string, error) {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xFF {
+			return "", errors.New(fmt.Sprintf("character %q is not in a single byte charset", r))
+		}
+		b = append(b, byte(r))
+	}
+	return string(b), nil
+}
+
+// fromLatin1 converts ISO-8859-1 bytes to UTF-8 text
+func fromLatin1(b []byte) string {
+	r := make([]rune, len(b))
+	for i, x := range b {
+		r[i] = rune(x)
+	}
+	return string(r)
+}
+
+// latin1Tags returns a copy of tag with the characters it writes converted to
+// ISO-8859-1, fields are encoded in ISO-8859-1 before they are transcoded
+func latin1Tags(tag *fixedTags) (t *fixedTags, err error) {
+	c := *tag
+	for _, s := range []*string{&c.Pad, &c.True, &c.False, &c.Unknown} {
+		if *s, err = toLatin1(*s); err != nil {
+			return
+		}
+	}
+	return &c, nil
+}
+
+func identityTable() (t [256]byte) {
+	for i := range t {
+		t[i] = byte(i)
+	}
+	return
+}
+
+// cp1047Table is CP037 with the brackets, caret, not sign, Y acute and
+// diaeresis moved
+func cp1047Table() [256]byte {
+	t := cp037Table
+	t[0x5F], t[0xB0] = 0x5E, 0xAC
+	t[0xAD], t[0xBA] = 0x5B, 0xDD
+	t[0xBD], t[0xBB] = 0x5D, 0xA8
+	return t
+}
+
+// cp037Table is the ISO-8859-1 character of every byte of EBCDIC CP037
+var cp037Table = [256]byte{
+	0x00, 0x01, 0x02, 0x03, 0x9C, 0x09, 0x86, 0x7F, 0x97, 0x8D, 0x8E, 0x0B, 0x0C, 0x0D, 0x0E, 0x0F,
+	0x10, 0x11, 0x12, 0x13, 0x9D, 0x85, 0x08, 0x87, 0x18, 0x19, 0x92, 0x8F, 0x1C, 0x1D, 0x1E, 0x1F,
+	0x80, 0x81, 0x82, 0x83, 0x84, 0x0A, 0x17, 0x1B, 0x88, 0x89, 0x8A, 0x8B, 0x8C, 0x05, 0x06, 0x07,
+	0x90, 0x91, 0x16, 0x93, 0x94, 0x95, 0x96, 0x04, 0x98, 0x99, 0x9A, 0x9B, 0x14, 0x15, 0x9E, 0x1A,
+	0x20, 0xA0, 0xE2, 0xE4, 0xE0, 0xE1, 0xE3, 0xE5, 0xE7, 0xF1, 0xA2, 0x2E, 0x3C, 0x28, 0x2B, 0x7C,
+	0x26, 0xE9, 0xEA, 0xEB, 0xE8, 0xED, 0xEE, 0xEF, 0xEC, 0xDF, 0x21, 0x24, 0x2A, 0x29, 0x3B, 0xAC,
+	0x2D, 0x2F, 0xC2, 0xC4, 0xC0, 0xC1, 0xC3, 0xC5, 0xC7, 0xD1, 0xA6, 0x2C, 0x25, 0x5F, 0x3E, 0x3F,
+	0xF8, 0xC9, 0xCA, 0xCB, 0xC8, 0xCD, 0xCE, 0xCF, 0xCC, 0x60, 0x3A, 0x23, 0x40, 0x27, 0x3D, 0x22,
+	0xD8, 0x61, 0x62, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x69, 0xAB, 0xBB, 0xF0, 0xFD, 0xFE, 0xB1,
+	0xB0, 0x6A, 0x6B, 0x6C, 0x6D, 0x6E, 0x6F, 0x70, 0x71, 0x72, 0xAA, 0xBA, 0xE6, 0xB8, 0xC6, 0xA4,
+	0xB5, 0x7E, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78, 0x79, 0x7A, 0xA1, 0xBF, 0xD0, 0xDD, 0xDE, 0xAE,
+	0x5E, 0xA3, 0xA5, 0xB7, 0xA9, 0xA7, 0xB6, 0xBC, 0xBD, 0xBE, 0x5B, 0x5D, 0xAF, 0xA8, 0xB4, 0xD7,
+	0x7B, 0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49, 0xAD, 0xF4, 0xF6, 0xF2, 0xF3, 0xF5,
+	0x7D, 0x4A, 0x4B, 0x4C, 0x4D, 0x4E, 0x4F, 0x50, 0x51, 0x52, 0xB9, 0xFB, 0xFC, 0xF9, 0xFA, 0xFF,
+	0x5C, 0xF7, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5A, 0xB2, 0xD4, 0xD6, 0xD2, 0xD3, 0xD5,
+	0x30, 0x31, 0x32, 0x33, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0xB3, 0xDB, 0xDC, 0xD9, 0xDA, 0x9F,
+}
+
+// CharsetMarshaler is implemented by the code fixedgen generates, Marshal
+// and Encoder call it rather than MarshalFixed to write text in a charset.
+// The records of other Marshalers are written as they are
+type CharsetMarshaler interface {
+	MarshalFixedCharset(c *Charset) ([]byte, error)
+}
+
+// CharsetUnmarshaler is the counterpart of CharsetMarshaler, Unmarshal and
+// Decoder call it rather than UnmarshalFixed to read text in a charset
+type CharsetUnmarshaler interface {
+	UnmarshalFixedCharset(data []byte, c *Charset) error
+}
+
+// EncodeOptions change how Marshal and Encoder write records
+type EncodeOptions struct {
+	// Charset transcodes text fields from UTF-8, []byte fields and packed
+	// numbers are written as they are. Fields with a charset tag use theirs
+	Charset *Charset
+}
+
+// charsetOf is the charset of a field, the one of its charset tag or else c
+func charsetOf(c *Charset, tag *fixedTags) *Charset {
+	if tag != nil && tag.Charset != "" {
+		return charsets[tag.Charset]
+	}
+	return c
+}
+
+// blankByte is a space in charset c
+func blankByte(c *Charset) byte {
+	if c == nil {
+		return ' '
+	}
+	return c.fromLatin1[' ']
+}
+
+// textValue reports whether val is written as text a charset applies to, the
+// leaves of the record except for []byte and packed numbers. Nil pointers
+// are written as text too
+func textValue(val reflect.Value, tag *fixedTags) bool {
+	if tag == nil || tag.Encoding == encodingPacked {
+		return false
+	}
+	switch val.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Struct:
+		return val.Type() == timeType
+	}
+	return false
+}
+
+// nilText reports whether val is a nil pointer to a field written as text,
+// blank packed numbers included
+func nilText(val reflect.Value, tag *fixedTags) bool {
+	return tag != nil && val.Kind() == reflect.Ptr && val.IsNil() && leafKind(val.Type()) != reflect.Slice
+}
+
+// packedBlank returns a packed field that is blank in charset cs as ASCII
+// spaces, the blank packedDecode knows
+func packedBlank(data []byte, cs *Charset) []byte {
+	blank := blankByte(cs)
+	for _, c := range data {
+		if c != blank {
+			return data
+		}
+	}
+	return bytes.Repeat([]byte(defaultPadString), len(data))
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// transcoder transcodes the ISO-8859-1 text written to it to a charset
+type transcoder struct {
+	w  io.Writer
+	cs *Charset
+}
+
+func (t *transcoder) Write(p []byte) (n int, err error) {
+	b := make([]byte, len(p))
+	copy(b, p)
+	t.cs.encodeLatin1(b)
+	return t.w.Write(b)
+}
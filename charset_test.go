@@ -0,0 +1,218 @@
+package fixedwidth
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+type charsetRec struct {
+	Name   string `fixed:"len:5"`
+	Amount int    `fixed:"len:3"`
+	Packed int    `fixed:"len:2,encoding:packed"`
+	Raw    []byte `fixed:"len:2"`
+	Note   string `fixed:"len:3,charset:latin1"`
+}
+
+// charsetData is charsetRec{"Bob", 12, 12, []byte{1, 2}, "é"} in CP037
+var charsetData = []byte{
+	0xC2, 0x96, 0x82, 0x40, 0x40,
+	0xF0, 0xF1, 0xF2,
+	0x01, 0x2C,
+	0x01, 0x02,
+	0xE9, 0x20, 0x20,
+}
+
+func TestMarshalCharset(t *testing.T) {
+	b, err := MarshalWithOptions(charsetRec{"Bob", 12, 12, []byte{1, 2}, "é"}, EncodeOptions{Charset: CharsetCP037})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, charsetData) {
+		t.Errorf("charsetRec encoded incorrectly expected: % X got: % X", charsetData, b)
+	}
+}
+
+func TestUnmarshalCharset(t *testing.T) {
+	var r charsetRec
+	if err := UnmarshalWithOptions(charsetData, &r, DecodeOptions{Charset: CharsetCP037, Strict: true}); err != nil {
+		t.Fatal(err)
+	}
+	if r.Name != "Bob" || r.Amount != 12 || r.Packed != 12 || !bytes.Equal(r.Raw, []byte{1, 2}) || r.Note != "é" {
+		t.Errorf("charsetRec decoded incorrectly expected: {Bob 12 12 [1 2] é} got: %v", r)
+	}
+}
+
+func TestCharsetUnencodable(t *testing.T) {
+	if _, err := MarshalWithOptions(charsetRec{Name: "€"}, EncodeOptions{Charset: CharsetCP037}); err == nil {
+		t.Error("expected an error encoding € in CP037")
+	}
+}
+
+func TestEncoderDecoderCharset(t *testing.T) {
+	type rec struct {
+		Name string `fixed:"len:4"`
+	}
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.SetCharset(CharsetCP1047)
+	for _, n := range []string{"[a]", "ü"} {
+		if err := enc.Encode(rec{n}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if strings.Contains(buf.String(), "\n") {
+		t.Errorf("terminator not transcoded got: % X", buf.Bytes())
+	}
+	dec := NewDecoder(&buf)
+	dec.SetCharset(CharsetCP1047)
+	for _, n := range []string{"[a]", "ü"} {
+		var r rec
+		if err := dec.Decode(&r); err != nil {
+			t.Fatal(err)
+		}
+		if r.Name != n {
+			t.Error("Name decoded incorrectly expected:", n, "got:", r.Name)
+		}
+	}
+}
+
+func TestCharsetRoundTrip(t *testing.T) {
+	for _, c := range []*Charset{CharsetLatin1, CharsetCP037, CharsetCP1047} {
+		for i := 0; i < 256; i += 1 {
+			s := string(rune(i))
+			b, err := c.Encode(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := c.Decode(b); got != s {
+				t.Errorf("%s round trip of %q incorrectly got: %q", c.Name, s, got)
+			}
+		}
+	}
+}
+
+func TestDecodeRecordCharset(t *testing.T) {
+	for _, term := range []Terminator{TerminatorLF, TerminatorNone} {
+		var buf bytes.Buffer
+		enc := NewEncoder(&buf)
+		enc.SetTerminator(term)
+		enc.SetCharset(CharsetCP037)
+		if err := enc.Encode(recHeader{"H", "Batch1"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := enc.Encode(recDetail{"D", 12}); err != nil {
+			t.Fatal(err)
+		}
+		dec := newRecDecoder(&buf)
+		dec.SetTerminator(term)
+		dec.SetCharset(CharsetCP037)
+		h, err := dec.DecodeRecord()
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := dec.DecodeRecord()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r, ok := h.(*recHeader); !ok || r.Name != "Batch1" {
+			t.Errorf("DecodeRecord incorrectly expected: &{H Batch1} got: %v", h)
+		}
+		if r, ok := d.(*recDetail); !ok || r.Amount != 12 {
+			t.Errorf("DecodeRecord incorrectly expected: &{D 12} got: %v", d)
+		}
+	}
+}
+
+func TestCharsetNilPacked(t *testing.T) {
+	type rec struct {
+		Packed *int   `fixed:"len:3,encoding:packed"`
+		Name   string `fixed:"len:2"`
+	}
+	b, err := MarshalWithOptions(rec{Name: "ab"}, EncodeOptions{Charset: CharsetCP037})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0x40, 0x40, 0x40, 0x81, 0x82}; !bytes.Equal(b, want) {
+		t.Errorf("rec encoded incorrectly expected: % X got: % X", want, b)
+	}
+	var r rec
+	if err := UnmarshalWithOptions(b, &r, DecodeOptions{Charset: CharsetCP037}); err != nil {
+		t.Fatal(err)
+	}
+	if r.Packed != nil || r.Name != "ab" {
+		t.Errorf("rec decoded incorrectly expected: {<nil> ab} got: %v", r)
+	}
+
+	l, err := NewLayout(rec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l = l.WithCharset(CharsetCP037)
+	data := l.Blank()
+	l.Field(0).PutNil(data)
+	if !bytes.Equal(data[:3], []byte{0x40, 0x40, 0x40}) {
+		t.Errorf("Packed PutNil incorrectly expected: 40 40 40 got: % X", data[:3])
+	}
+	if _, valid, err := l.Field(0).DecodeInt(data, 0); err != nil || valid {
+		t.Error("Packed blank decoded incorrectly expected: not valid got:", valid, err)
+	}
+}
+
+func TestCharsetGenerated(t *testing.T) {
+	count := int32(7)
+	src := genRecord{
+		Name:    "Zoë",
+		Number:  -42,
+		Amount:  12.5,
+		Flag:    true,
+		Date:    time.Date(1990, 11, 16, 0, 0, 0, 0, time.UTC),
+		Count:   &count,
+		Code:    []byte{0x01, 0x02},
+		Address: nestedAddress{"Main", 42},
+		Zoned:   -120,
+	}
+	var generated, plain bytes.Buffer
+	for _, c := range []struct {
+		buf *bytes.Buffer
+		v   interface{}
+	}{{&generated, src}, {&plain, genRecordPlain(src)}} {
+		enc := NewEncoder(c.buf)
+		enc.SetCharset(CharsetCP037)
+		if err := enc.Encode(c.v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(generated.Bytes(), plain.Bytes()) {
+		t.Errorf("Generated marshal incorrectly expected: % X got: % X", plain.Bytes(), generated.Bytes())
+	}
+
+	dec := NewDecoder(&generated)
+	dec.SetCharset(CharsetCP037)
+	var res genRecord
+	if err := dec.Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Name != "Zoë" || res.Number != -42 || res.Amount != 12.5 || *res.Count != 7 ||
+		!bytes.Equal(res.Code, src.Code) || res.Address != src.Address || res.Zoned != -120 {
+		t.Errorf("Generated unmarshal incorrectly expected: %+v got: %+v", src, res)
+	}
+}
+
+// rawMarshaler writes its record itself
+type rawMarshaler struct{}
+
+func (rawMarshaler) MarshalFixed() ([]byte, error) {
+	return []byte("ab"), nil
+}
+
+func TestCharsetMarshalerAsIs(t *testing.T) {
+	b, err := MarshalWithOptions(rawMarshaler{}, EncodeOptions{Charset: CharsetCP037})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "ab" {
+		t.Errorf("rawMarshaler encoded incorrectly expected: ab got: % X", b)
+	}
+}
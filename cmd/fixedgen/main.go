@@ -0,0 +1,494 @@
+// Command fixedgen generates MarshalFixed and UnmarshalFixed methods for
+// structs with fixed tags. The generated methods format every column with the
+// same code as fixedwidth.Marshal and fixedwidth.Unmarshal so their output is
+// identical, but they do not walk the struct with reflection.
+//
+// Usage, typically from a go:generate comment next to the struct:
+//
+//	//go:generate fixedgen -type Record,Header
+//
+// Fields of types fixedgen has no specialised code for, nested structs or
+// named types for example, still go through reflection one column at a time.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const importPath = "github.com/pborges/fixed"
+const tagName = "fixed"
+
+func main() {
+	typeNames := flag.String("type", "", "comma separated list of struct type names, required")
+	output := flag.String("output", "", "output file name, default <type>_fixed.go")
+	flag.Parse()
+	if *typeNames == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	dir := "."
+	if flag.NArg() > 0 {
+		dir = flag.Arg(0)
+	}
+
+	types := strings.Split(*typeNames, ",")
+	src, test, err := generate(dir, types)
+	if err != nil {
+		log.Fatal("fixedgen: ", err)
+	}
+	name := *output
+	if name == "" {
+		name = strings.ToLower(types[0]) + "_fixed.go"
+		if test {
+			name = strings.ToLower(types[0]) + "_fixed_test.go"
+		}
+	}
+	if err = ioutil.WriteFile(outputPath(dir, name), src, 0644); err != nil {
+		log.Fatal("fixedgen: ", err)
+	}
+}
+
+// outputPath is where the generated file goes, a relative name is in dir
+func outputPath(dir string, name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(dir, name)
+}
+
+// generate returns the formatted source of the methods for the given types
+// of the package in dir, test is set when the types are declared in test files
+func generate(dir string, types []string) (src []byte, test bool, err error) {
+	fset := token.NewFileSet()
+	var pkgs map[string]*ast.Package
+	if pkgs, err = parser.ParseDir(fset, dir, nil, 0); err != nil {
+		return
+	}
+
+	g := generator{}
+	for _, name := range types {
+		g.generated = append(g.generated, name)
+	}
+	for _, name := range types {
+		var spec *ast.TypeSpec
+		var pkg string
+		var file string
+		for pkgName, p := range pkgs {
+			for fileName, f := range p.Files {
+				if s := findType(f, name); s != nil {
+					spec, pkg, file = s, pkgName, fileName
+				}
+			}
+		}
+		if spec == nil {
+			err = errors.New(fmt.Sprintf("type %s not found in %s", name, dir))
+			return
+		}
+		st, ok := spec.Type.(*ast.StructType)
+		if !ok {
+			err = errors.New(fmt.Sprintf("type %s is not a struct", name))
+			return
+		}
+		if g.pkg != "" && g.pkg != pkg {
+			err = errors.New(fmt.Sprintf("types are declared in packages %s and %s", g.pkg, pkg))
+			return
+		}
+		g.pkg = pkg
+		g.scan(pkgs[pkg])
+		test = strings.HasSuffix(file, "_test.go")
+		if err = g.addType(name, st); err != nil {
+			return
+		}
+	}
+	src, err = g.source()
+	return
+}
+
+func findType(f *ast.File, name string) *ast.TypeSpec {
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, s := range gen.Specs {
+			if spec := s.(*ast.TypeSpec); spec.Name.Name == name {
+				return spec
+			}
+		}
+	}
+	return nil
+}
+
+// column is one field of a generated struct
+type column struct {
+	name   string
+	filler bool
+	ptr    bool
+	// the Go type of the field without the pointer, "int64" or "time.Time"
+	goType string
+	// the Field method suffix, "Int" for PutInt/DecodeInt, "Value" for
+	// the reflective fallback
+	method string
+	bits   int
+}
+
+type generator struct {
+	pkg   string
+	types []string
+	cols  map[string][]column
+	buf   bytes.Buffer
+	// the types of the package by name and those with a MarshalFixed or
+	// UnmarshalFixed method, the types being generated included
+	decls      map[string]ast.Expr
+	marshalers map[string]bool
+	generated  []string
+}
+
+// scan collects the type declarations and marshalers of the package
+func (g *generator) scan(p *ast.Package) {
+	g.decls = make(map[string]ast.Expr)
+	g.marshalers = make(map[string]bool)
+	for _, name := range g.generated {
+		g.marshalers[name] = true
+	}
+	for _, f := range p.Files {
+		for _, decl := range f.Decls {
+			switch d := decl.(type) {
+			case *ast.GenDecl:
+				if d.Tok != token.TYPE {
+					continue
+				}
+				for _, s := range d.Specs {
+					spec := s.(*ast.TypeSpec)
+					g.decls[spec.Name.Name] = spec.Type
+				}
+			case *ast.FuncDecl:
+				if d.Recv == nil || len(d.Recv.List) == 0 || (d.Name.Name != "MarshalFixed" && d.Name.Name != "UnmarshalFixed") {
+					continue
+				}
+				recv := d.Recv.List[0].Type
+				if star, ok := recv.(*ast.StarExpr); ok {
+					recv = star.X
+				}
+				if id, ok := recv.(*ast.Ident); ok {
+					g.marshalers[id.Name] = true
+				}
+			}
+		}
+	}
+}
+
+// inline reports whether an untagged field of type expr is laid out inline
+// in the record like Marshal does, a struct without its own marshaler. Types
+// of other packages can not be told apart and are an error
+func (g *generator) inline(field string, expr ast.Expr) (ok bool, err error) {
+	switch t := expr.(type) {
+	case *ast.StructType:
+		return true, nil
+	case *ast.Ident:
+		decl, found := g.decls[t.Name]
+		if !found {
+			return
+		}
+		if _, isStruct := decl.(*ast.StructType); !isStruct {
+			if id, alias := decl.(*ast.Ident); alias && id.Name != t.Name {
+				return g.inline(field, id)
+			}
+			return
+		}
+		if g.marshalers[t.Name] {
+			err = errors.New(fmt.Sprintf("missing len tag on field %s, %s has its own marshaler", field, t.Name))
+			return
+		}
+		return true, nil
+	case *ast.ArrayType:
+		// arrays and slices of structs are not laid out inline, Marshal
+		// requires a len tag on them
+		elem := t.Elt
+		for {
+			if star, isPtr := elem.(*ast.StarExpr); isPtr {
+				elem = star.X
+			} else if arr, isArr := elem.(*ast.ArrayType); isArr {
+				elem = arr.Elt
+			} else {
+				break
+			}
+		}
+		if ok, err = g.inline(field, elem); ok {
+			ok, err = false, errors.New(fmt.Sprintf("missing len tag on field %s, it repeats a struct", field))
+		}
+		return
+	case *ast.SelectorExpr:
+		if x, isIdent := t.X.(*ast.Ident); isIdent && x.Name == "time" && t.Sel.Name == "Time" {
+			return
+		}
+		err = errors.New(fmt.Sprintf("untagged field %s has a type of another package, tag it so fixedgen knows its width", field))
+	}
+	return
+}
+
+func (g *generator) addType(name string, st *ast.StructType) (err error) {
+	if g.cols == nil {
+		g.cols = make(map[string][]column)
+	}
+	var cols []column
+	for _, f := range st.Fields.List {
+		var tag string
+		tagged := false
+		if f.Tag != nil {
+			var raw string
+			if raw, err = strconv.Unquote(f.Tag.Value); err != nil {
+				return
+			}
+			tag, tagged = reflect.StructTag(raw).Lookup(tagName)
+		}
+		if len(f.Names) == 0 {
+			// Marshal promotes the fields of embedded structs
+			err = errors.New(fmt.Sprintf("%s: embedded fields are not supported", name))
+			return
+		}
+		if !tagged {
+			// untagged nested structs are laid out inline
+			for _, n := range f.Names {
+				if !ast.IsExported(n.Name) {
+					continue
+				}
+				var ok bool
+				if ok, err = g.inline(n.Name, f.Type); err != nil {
+					err = errors.New(fmt.Sprintf("%s: %s", name, err))
+					return
+				}
+				if ok {
+					cols = append(cols, column{name: n.Name, method: "Value"})
+				}
+			}
+			continue
+		}
+		if strings.Contains(tag, "dependsOn:") || measuredInCharacters(tag) {
+			err = errors.New(fmt.Sprintf("%s: variable length fields are not supported", name))
+			return
+		}
+		col := column{filler: tag == "-" || strings.HasPrefix(tag, "-,")}
+		if !col.filler {
+			col.classify(f.Type)
+		}
+		for _, n := range f.Names {
+			// unexported fields can only be fillers, Marshal skips them
+			if !col.filler && !ast.IsExported(n.Name) {
+				continue
+			}
+			col.name = n.Name
+			cols = append(cols, col)
+		}
+	}
+	g.types = append(g.types, name)
+	g.cols[name] = cols
+	return
+}
+
+// measuredInCharacters reports whether a tag has a width other than bytes,
+// the field then takes up a variable number of bytes
+func measuredInCharacters(tag string) bool {
+	for _, kv := range strings.Split(tag, ",") {
+		if strings.HasPrefix(kv, "width:") && kv != "width:bytes" {
+			return true
+		}
+	}
+	return false
+}
+
+// basic maps the builtin types to their Field method and bit size
+var basic = map[string]struct {
+	method string
+	bits   int
+}{
+	"string":  {"String", 0},
+	"bool":    {"Bool", 0},
+	"int":     {"Int", 0},
+	"int8":    {"Int", 8},
+	"int16":   {"Int", 16},
+	"int32":   {"Int", 32},
+	"rune":    {"Int", 32},
+	"int64":   {"Int", 64},
+	"uint":    {"Uint", 0},
+	"uint8":   {"Uint", 8},
+	"byte":    {"Uint", 8},
+	"uint16":  {"Uint", 16},
+	"uint32":  {"Uint", 32},
+	"uint64":  {"Uint", 64},
+	"float32": {"Float", 32},
+	"float64": {"Float", 64},
+}
+
+func (c *column) classify(expr ast.Expr) {
+	c.method = "Value"
+	if star, ok := expr.(*ast.StarExpr); ok {
+		c.ptr = true
+		expr = star.X
+	}
+	switch t := expr.(type) {
+	case *ast.Ident:
+		c.goType = t.Name
+		if b, ok := basic[t.Name]; ok {
+			c.method, c.bits = b.method, b.bits
+			return
+		}
+	case *ast.SelectorExpr:
+		if x, ok := t.X.(*ast.Ident); ok && x.Name == "time" && t.Sel.Name == "Time" {
+			c.goType, c.method = "time.Time", "Time"
+			return
+		}
+	case *ast.ArrayType:
+		if elt, ok := t.Elt.(*ast.Ident); ok && t.Len == nil && !c.ptr && (elt.Name == "byte" || elt.Name == "uint8") {
+			c.goType, c.method = "[]byte", "Bytes"
+			return
+		}
+	}
+	// anything else goes through reflection, pointers included
+	c.ptr = false
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *generator) source() (src []byte, err error) {
+	qual := "fixedwidth."
+	g.printf("// Code generated by fixedgen; DO NOT EDIT.\n\n")
+	g.printf("package %s\n\n", g.pkg)
+	if g.pkg == "fixedwidth" {
+		qual = ""
+	} else {
+		g.printf("import fixedwidth %q\n\n", importPath)
+	}
+	for _, name := range g.types {
+		g.writeType(name, qual)
+	}
+	if src, err = format.Source(g.buf.Bytes()); err != nil {
+		err = errors.New(fmt.Sprintf("formatting generated code: %s\n%s", err, g.buf.String()))
+	}
+	return
+}
+
+func (g *generator) writeType(name string, qual string) {
+	cols := g.cols[name]
+	layout := "fixedLayout" + strings.ToUpper(name[:1]) + name[1:]
+	names := make([]string, len(cols))
+	for i, c := range cols {
+		names[i] = strconv.Quote(c.name)
+	}
+	g.printf("var %s = %sMustLayout(%s{}, %s)\n\n", layout, qual, name, strings.Join(names, ", "))
+
+	g.printf("// MarshalFixed implements %sMarshaler\n", qual)
+	g.printf("func (r %s) MarshalFixed() ([]byte, error) {\nreturn r.marshalFixed(%s)\n}\n\n", name, layout)
+	g.printf("// MarshalFixedCharset implements %sCharsetMarshaler\n", qual)
+	g.printf("func (r %s) MarshalFixedCharset(c *%sCharset) ([]byte, error) {\n", name, qual)
+	g.printf("return r.marshalFixed(%s.WithCharset(c))\n}\n\n", layout)
+	g.printf("func (r %s) marshalFixed(l *%sLayout) ([]byte, error) {\n", name, qual)
+	g.printf("rec := l.Blank()\n")
+	for i, c := range cols {
+		g.writePut(i, c)
+	}
+	g.printf("return rec, nil\n}\n\n")
+
+	g.printf("// UnmarshalFixed implements %sUnmarshaler\n", qual)
+	g.printf("func (r *%s) UnmarshalFixed(data []byte) error {\nreturn r.unmarshalFixed(data, %s)\n}\n\n", name, layout)
+	g.printf("// UnmarshalFixedCharset implements %sCharsetUnmarshaler\n", qual)
+	g.printf("func (r *%s) UnmarshalFixedCharset(data []byte, c *%sCharset) error {\n", name, qual)
+	g.printf("return r.unmarshalFixed(data, %s.WithCharset(c))\n}\n\n", layout)
+	g.printf("func (r *%s) unmarshalFixed(data []byte, l *%sLayout) error {\n", name, qual)
+	for i, c := range cols {
+		g.writeDecode(i, c)
+	}
+	g.printf("return nil\n}\n\n")
+}
+
+// putArg converts the field value to the argument type of its Put method
+func (c column) putArg(v string) string {
+	switch c.method {
+	case "Int":
+		return "int64(" + v + ")"
+	case "Uint":
+		return "uint64(" + v + ")"
+	case "Float":
+		return fmt.Sprintf("float64(%s), %d", v, c.bits)
+	case "String", "Bool":
+		return c.goType + "(" + v + ")"
+	}
+	return v
+}
+
+func (g *generator) writePut(i int, c column) {
+	field := fmt.Sprintf("l.Field(%d)", i)
+	switch {
+	case c.filler:
+		g.printf("%s.PutFiller(rec)\n", field)
+	case c.ptr:
+		g.printf("if r.%s == nil {\n%s.PutNil(rec)\n", c.name, field)
+		g.printf("} else if err := %s.Put%s(rec, %s); err != nil {\nreturn nil, err\n}\n", field, c.method, c.putArg("*r."+c.name))
+	default:
+		g.printf("if err := %s.Put%s(rec, %s); err != nil {\nreturn nil, err\n}\n", field, c.method, c.putArg("r."+c.name))
+	}
+}
+
+// decodeArgs are the arguments of the Decode method after the record
+func (c column) decodeArgs() string {
+	switch c.method {
+	case "Int", "Uint", "Float":
+		return fmt.Sprintf(", %d", c.bits)
+	}
+	return ""
+}
+
+func (g *generator) writeDecode(i int, c column) {
+	if c.filler {
+		return
+	}
+	field := fmt.Sprintf("l.Field(%d)", i)
+	if c.method == "Value" {
+		g.printf("if err := %s.DecodeValue(data, &r.%s); err != nil {\nreturn err\n}\n", field, c.name)
+		return
+	}
+	conv := c.goType + "(v)"
+	if c.method == "Time" || c.method == "Bytes" {
+		conv = "v"
+	}
+	// strings and bytes are set even when blank, like Unmarshal does
+	always := c.method == "String" || c.method == "Bytes"
+
+	ok := "ok"
+	if always && !c.ptr {
+		ok = "_"
+	}
+	g.printf("{\nv, %s, err := %s.Decode%s(data%s)\n", ok, field, c.method, c.decodeArgs())
+	g.printf("if err != nil {\nreturn err\n}\n")
+	switch {
+	case c.ptr:
+		g.printf("if r.%s != nil {\n", c.name)
+		if always {
+			g.printf("*r.%s = %s\n", c.name, conv)
+		} else {
+			g.printf("if ok {\n*r.%s = %s\n}\n", c.name, conv)
+		}
+		g.printf("} else if ok {\nx := %s\nr.%s = &x\n}\n", conv, c.name)
+	case always:
+		g.printf("r.%s = %s\n", c.name, conv)
+	default:
+		g.printf("if ok {\nr.%s = %s\n}\n", c.name, conv)
+	}
+	g.printf("}\n")
+}
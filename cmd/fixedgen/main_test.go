@@ -0,0 +1,63 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// generateSource runs generate on a package made of src
+func generateSource(t *testing.T, src string, types ...string) (string, error) {
+	dir, err := ioutil.TempDir("", "fixedgen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = ioutil.WriteFile(filepath.Join(dir, "rec.go"), []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, _, err := generate(dir, types)
+	return string(out), err
+}
+
+func TestGenerateRejectsWidth(t *testing.T) {
+	for _, tag := range []string{"len:5,width:runes", "len:5,width:display"} {
+		src := "package rec\n\ntype Rec struct {\n\tName string `fixed:\"" + tag + "\"`\n}\n"
+		if _, err := generateSource(t, src, "Rec"); err == nil {
+			t.Error("Expected error generating a field with", tag)
+		}
+	}
+	src := "package rec\n\ntype Rec struct {\n\tName string `fixed:\"len:5,width:bytes\"`\n}\n"
+	out, err := generateSource(t, src, "Rec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "PutString") {
+		t.Error("Generated code incorrectly expected PutString got:", out)
+	}
+}
+
+func TestGenerateRejectsUntaggedArray(t *testing.T) {
+	for _, typ := range []string{"[2]Item", "[]*Item", "[]struct{ A string `fixed:\"len:1\"` }"} {
+		src := "package rec\n\ntype Item struct {\n\tCode string `fixed:\"len:2\"`\n}\n\ntype Rec struct {\n\tItems " + typ + "\n}\n"
+		if _, err := generateSource(t, src, "Rec"); err == nil {
+			t.Error("Expected error generating an untagged", typ)
+		}
+	}
+	src := "package rec\n\ntype Rec struct {\n\tName  string `fixed:\"len:5\"`\n\tCodes []string\n}\n"
+	if _, err := generateSource(t, src, "Rec"); err != nil {
+		t.Error("Unexpected error generating an untagged []string:", err)
+	}
+}
+
+func TestOutputPath(t *testing.T) {
+	abs := filepath.Join(os.TempDir(), "gen_out.go")
+	if p := outputPath("pkg", abs); p != abs {
+		t.Error("Output path incorrectly expected:", abs, "got:", p)
+	}
+	if p := outputPath("pkg", "gen_out.go"); p != filepath.Join("pkg", "gen_out.go") {
+		t.Error("Output path incorrectly expected:", filepath.Join("pkg", "gen_out.go"), "got:", p)
+	}
+}
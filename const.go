@@ -6,9 +6,47 @@ const tagPad = "pad"
 const tagLen = "len"
 const tagFormat = "format"
 const tagAlign = "align"
+const tagDecimals = "decimals"
+const tagImplied = "implied"
+const tagSign = "sign"
+const tagEncoding = "encoding"
+const tagTrue = "true"
+const tagFalse = "false"
+const tagUnknown = "unknown"
+const tagCount = "count"
+const tagDependsOn = "dependsOn"
+const tagPos = "pos"
+const tagStart = "start"
+const tagEnd = "end"
+const tagFiller = "-"
+const tagOverflow = "overflow"
+const tagTotal = "total"
+const tagCharset = "charset"
+const tagWidth = "width"
 
 const defaultPadInt = "0"
 const defaultPadString = " "
+const defaultTrue = "1"
+const defaultFalse = "0"
 
 const alignLeft = "left"
 const alignRight = "right"
+
+const signLeading = "leading"
+const signTrailing = "trailing"
+const signAlways = "always"
+const signSeparate = "separate"
+
+const encodingText = "text"
+const encodingZoned = "zoned"
+const encodingPacked = "packed"
+
+// the total of a trailer field counting the records instead of summing a field
+const totalRecords = "records"
+
+const widthBytes = "bytes"
+const widthRunes = "runes"
+const widthDisplay = "display"
+
+const overflowError = "error"
+const overflowTruncate = "truncate"
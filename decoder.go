@@ -0,0 +1,139 @@
+package fixedwidth
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// Decoder reads fixed width records from an io.Reader
+type Decoder struct {
+	r          *bufio.Reader
+	terminator Terminator
+	opts       DecodeOptions
+	totals     *Totals
+	// number of records read so far
+	record int
+	// column range of the record type code for DecodeRecord and the struct
+	// types registered for the codes
+	discStart   int
+	discEnd     int
+	recordTypes map[string]reflect.Type
+}
+
+// NewDecoder returns a Decoder that reads one record per line from r
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r), terminator: TerminatorLF}
+}
+
+// SetTerminator changes how the input is split into records. With
+// TerminatorLF or TerminatorCRLF records are read line by line, with
+// TerminatorNone every record is exactly as long as the struct passed to Decode.
+func (d *Decoder) SetTerminator(t Terminator) {
+	d.terminator = t
+}
+
+// SetOptions changes how malformed records are treated, see DecodeOptions
+func (d *Decoder) SetOptions(opts DecodeOptions) {
+	d.opts = opts
+}
+
+// More reports whether there is another record in the input
+func (d *Decoder) More() bool {
+	_, err := d.r.Peek(1)
+	return err == nil
+}
+
+// Decode reads the next record and stores it in the value pointed to by v,
+// at the end of the input it returns io.EOF. A *FieldError carries the
+// number of the record it was found in
+func (d *Decoder) Decode(v interface{}) (err error) {
+	var data []byte
+	if d.terminator == TerminatorNone {
+		data, err = d.readFixed(reflect.TypeOf(v))
+	} else {
+		data, err = d.readLine()
+	}
+	if err != nil {
+		return
+	}
+	d.record++
+	if err = UnmarshalWithOptions(data, v, d.opts); err != nil {
+		return d.recordError(err)
+	}
+	return d.total(v)
+}
+
+// recordError sets the number of the current record on field errors
+func (d *Decoder) recordError(err error) error {
+	var fe *FieldError
+	if errors.As(err, &fe) {
+		fe.Record = d.record
+	}
+	return err
+}
+
+// SetTotals makes the Decoder add every record it reads to t, the total
+// fields of trailers are verified against t
+func (d *Decoder) SetTotals(t *Totals) {
+	d.totals = t
+}
+
+func (d *Decoder) total(v interface{}) error {
+	if d.totals == nil {
+		return nil
+	}
+	if hasTotals(v) {
+		return d.totals.Verify(v)
+	}
+	return d.totals.Add(v)
+}
+
+// SetCharset makes the Decoder read text fields and the terminator in c, nil
+// reads them in UTF-8. It replaces the charset of the options
+func (d *Decoder) SetCharset(c *Charset) {
+	d.opts.Charset = c
+}
+
+func (d *Decoder) readLine() (data []byte, err error) {
+	lf, cr := byte('\n'), byte('\r')
+	if d.opts.Charset != nil {
+		lf, cr = d.opts.Charset.fromLatin1[lf], d.opts.Charset.fromLatin1[cr]
+	}
+	data, err = d.r.ReadBytes(lf)
+	if err == io.EOF && len(data) > 0 {
+		err = nil
+	}
+	if err != nil {
+		return
+	}
+	data = bytes.TrimSuffix(data, []byte{lf})
+	data = bytes.TrimSuffix(data, []byte{cr})
+	return
+}
+
+func (d *Decoder) readFixed(t reflect.Type) (data []byte, err error) {
+	var l int
+	if l, err = recordLen(t); err != nil {
+		return
+	}
+	if hasColumns(t) {
+		err = errors.New(fmt.Sprintf("record length of %s is variable, it has fields measured in characters", t))
+		return
+	}
+	if l == 0 {
+		err = errors.New(fmt.Sprintf("cannot determine record length of %s", t))
+		return
+	}
+	data = make([]byte, l)
+	var n int
+	n, err = io.ReadFull(d.r, data)
+	if err == io.ErrUnexpectedEOF && d.opts.PadShort {
+		// the last record was cut short
+		data, err = data[:n], nil
+	}
+	return
+}
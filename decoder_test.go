@@ -0,0 +1,94 @@
+package fixedwidth
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+type decoderRec struct {
+	Number int    `fixed:"len:4"`
+	String string `fixed:"len:5"`
+}
+
+func TestDecoder(t *testing.T) {
+	dec := NewDecoder(strings.NewReader("0001Hello\r\n0022Bye  \n0333End  "))
+	var res []decoderRec
+	for dec.More() {
+		var r decoderRec
+		if err := dec.Decode(&r); err != nil {
+			t.Fatal(err)
+		}
+		res = append(res, r)
+	}
+	if len(res) != 3 {
+		t.Fatal("Decoder incorrectly expected 3 records got:", len(res))
+	}
+	if res[1].Number != 22 || res[1].String != "Bye" {
+		t.Error("Decoder incorrectly expected: {22 Bye} got:", res[1])
+	}
+	if res[2].Number != 333 || res[2].String != "End" {
+		t.Error("Decoder incorrectly expected: {333 End} got:", res[2])
+	}
+	if err := dec.Decode(&decoderRec{}); err != io.EOF {
+		t.Error("Decoder incorrectly expected EOF got:", err)
+	}
+}
+
+func TestDecoderRecordNumber(t *testing.T) {
+	dec := NewDecoder(strings.NewReader("0001Hello\n00x2Bye  \n"))
+	if err := dec.Decode(&decoderRec{}); err != nil {
+		t.Fatal(err)
+	}
+	err := dec.Decode(&decoderRec{})
+	var fe *FieldError
+	if !errors.As(err, &fe) || fe.Record != 2 || fe.Field != "Number" {
+		t.Fatal("Decoder incorrectly expected a FieldError in record 2 got:", err)
+	}
+	if !strings.HasPrefix(err.Error(), "fixedwidth: record 2: field decoderRec.Number") {
+		t.Error("Decoder incorrectly expected the record number in:", err)
+	}
+	if err := Unmarshal([]byte("00x2Bye  "), &decoderRec{}); !errors.As(err, &fe) || fe.Record != 0 {
+		t.Error("Unmarshal incorrectly expected a FieldError without a record number got:", err)
+	}
+}
+
+func TestDecoderFixedLength(t *testing.T) {
+	dec := NewDecoder(strings.NewReader("0001Hello0022Bye  0333"))
+	dec.SetTerminator(TerminatorNone)
+	var r decoderRec
+	if err := dec.Decode(&r); err != nil || r.Number != 1 || r.String != "Hello" {
+		t.Error("Decoder incorrectly expected: {1 Hello} got:", r, err)
+	}
+	if err := dec.Decode(&r); err != nil || r.Number != 22 || r.String != "Bye" {
+		t.Error("Decoder incorrectly expected: {22 Bye} got:", r, err)
+	}
+	if err := dec.Decode(&r); err != io.ErrUnexpectedEOF {
+		t.Error("Decoder incorrectly expected ErrUnexpectedEOF got:", err)
+	}
+}
+
+func TestDecoderPadShort(t *testing.T) {
+	dec := NewDecoder(strings.NewReader("0001Hello\n0022By\n0333\n"))
+	if err := dec.Decode(&decoderRec{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := dec.Decode(&decoderRec{}); !errors.Is(err, ErrShortRecord) {
+		t.Error("Decoder incorrectly expected ErrShortRecord got:", err)
+	}
+
+	dec.SetOptions(DecodeOptions{PadShort: true})
+	r := decoderRec{String: "Keep"}
+	if err := dec.Decode(&r); err != nil || r.Number != 333 || r.String != "Keep" {
+		t.Error("Decoder incorrectly expected: {333 Keep} got:", r, err)
+	}
+
+	dec = NewDecoder(strings.NewReader("0001Hello0022By"))
+	dec.SetTerminator(TerminatorNone)
+	dec.SetOptions(DecodeOptions{PadShort: true})
+	dec.Decode(&r)
+	if err := dec.Decode(&r); err != nil || r.Number != 22 || r.String != "By" {
+		t.Error("Decoder incorrectly expected: {22 By} got:", r, err)
+	}
+}
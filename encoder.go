@@ -0,0 +1,81 @@
+package fixedwidth
+
+import (
+	"io"
+	"reflect"
+)
+
+// Terminator is the byte sequence an Encoder writes after every record
+type Terminator string
+
+const (
+	TerminatorNone Terminator = ""
+	TerminatorLF   Terminator = "\n"
+	TerminatorCRLF Terminator = "\r\n"
+)
+
+// Encoder writes fixed width records to an io.Writer
+type Encoder struct {
+	w          io.Writer
+	terminator Terminator
+	totals     *Totals
+	opts       EncodeOptions
+}
+
+// NewEncoder returns an Encoder that writes one record per line to w.
+// Records are written straight to w, wrap it in a bufio.Writer when
+// writing large files.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w, terminator: TerminatorLF}
+}
+
+// SetTerminator changes the sequence written after each record, use
+// TerminatorNone for files where records are only delimited by length
+func (e *Encoder) SetTerminator(t Terminator) {
+	e.terminator = t
+}
+
+// SetCharset makes the Encoder write text fields and the terminator in c,
+// nil writes them in UTF-8
+func (e *Encoder) SetCharset(c *Charset) {
+	e.opts.Charset = c
+}
+
+// SetTotals makes the Encoder add every record it writes to t, the total
+// fields of trailers are filled in from t before they are written. A trailer
+// passed by pointer is updated
+func (e *Encoder) SetTotals(t *Totals) {
+	e.totals = t
+}
+
+// Encode writes the fixed width encoding of v followed by the record terminator
+func (e *Encoder) Encode(v interface{}) (err error) {
+	trailer := e.totals != nil && hasTotals(v)
+	if trailer {
+		val := reflect.ValueOf(v)
+		if val.Kind() != reflect.Ptr {
+			cp := reflect.New(val.Type())
+			cp.Elem().Set(val)
+			v = cp.Interface()
+		}
+		if err = e.totals.Fill(v); err != nil {
+			return
+		}
+	}
+	if err = marshalRecursive(e.w, e.opts, nil, nil, reflect.ValueOf(v)); err != nil {
+		return
+	}
+	if e.totals != nil && !trailer {
+		if err = e.totals.Add(v); err != nil {
+			return
+		}
+	}
+	if e.terminator != TerminatorNone {
+		w := e.w
+		if e.opts.Charset != nil {
+			w = &transcoder{w: w, cs: e.opts.Charset}
+		}
+		_, err = io.WriteString(w, string(e.terminator))
+	}
+	return
+}
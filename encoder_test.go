@@ -0,0 +1,64 @@
+package fixedwidth
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncoder(t *testing.T) {
+	type rec struct {
+		Number int    `fixed:"len:4"`
+		String string `fixed:"len:5"`
+	}
+	buf := bytes.Buffer{}
+	enc := NewEncoder(&buf)
+	for _, r := range []rec{{1, "Hello"}, {22, "Bye"}} {
+		if err := enc.Encode(r); err != nil {
+			t.Error(err)
+		}
+	}
+	data := "0001Hello\n0022Bye  \n"
+	if buf.String() != data {
+		t.Errorf("Encoder incorrectly expected: %q got: %q", data, buf.String())
+	}
+}
+
+func TestEncoderTerminator(t *testing.T) {
+	src := struct {
+		String string `fixed:"len:4"`
+	}{String: "AB"}
+	for term, data := range map[Terminator]string{
+		TerminatorNone: "AB  AB  ",
+		TerminatorLF:   "AB  \nAB  \n",
+		TerminatorCRLF: "AB  \r\nAB  \r\n",
+	} {
+		buf := bytes.Buffer{}
+		enc := NewEncoder(&buf)
+		enc.SetTerminator(term)
+		enc.Encode(src)
+		enc.Encode(&src)
+		if buf.String() != data {
+			t.Errorf("Encoder incorrectly expected: %q got: %q", data, buf.String())
+		}
+	}
+}
+
+func TestEncoderMatchesMarshal(t *testing.T) {
+	src := struct {
+		Number1 *int `fixed:"len:4,pad: "`
+		Number2 int  `fixed:"len:4,base:16"`
+	}{Number2: 255}
+	data, err := Marshal(src)
+	if err != nil {
+		t.Error(err)
+	}
+	buf := bytes.Buffer{}
+	enc := NewEncoder(&buf)
+	enc.SetTerminator(TerminatorNone)
+	if err := enc.Encode(src); err != nil {
+		t.Error(err)
+	}
+	if bytes.Compare(buf.Bytes(), data) != 0 {
+		t.Error("Encoder incorrectly expected:", data, "got:", buf.Bytes())
+	}
+}
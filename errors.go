@@ -0,0 +1,99 @@
+package fixedwidth
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// FieldError is returned by Marshal and Unmarshal when a single field could
+// not be converted. Errors in nested structs are reported for the innermost
+// field, with Field holding the path from the outer struct and Offset the
+// column in the outer record
+type FieldError struct {
+	// number of the record in the input of a Decoder counting from 1, the
+	// line number unless the terminator is TerminatorNone. 0 for Unmarshal
+	Record int
+	// name of the struct type the field path starts at
+	Struct string
+	// name of the field, "Address.Street" for nested structs
+	Field string
+	// zero based start of the field in the record and its width
+	Offset int
+	Len    int
+	// the bytes of the field, nil when marshaling
+	Raw []byte
+	Err error
+}
+
+func (e *FieldError) Error() string {
+	// anonymous structs have no name, errors outside of fields no field
+	what := "field " + strings.TrimPrefix(e.Struct+"."+e.Field, ".")
+	if e.Field == "" {
+		what = "record " + e.Struct
+	}
+	if e.Record > 0 {
+		what = fmt.Sprintf("record %d: %s", e.Record, what)
+	}
+	if e.Raw != nil {
+		return fmt.Sprintf("fixedwidth: %s at offset %d len %d %q: %s", what, e.Offset, e.Len, e.Raw, e.Err)
+	}
+	return fmt.Sprintf("fixedwidth: %s at offset %d len %d: %s", what, e.Offset, e.Len, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// UnsupportedTypeError is returned for values of a type that has no fixed
+// width representation, maps or channels for example
+type UnsupportedTypeError struct {
+	Type reflect.Type
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	if e.Type == nil {
+		return "fixedwidth: unsupported type: nil"
+	}
+	return "fixedwidth: unsupported type: " + e.Type.String()
+}
+
+// OverflowError is returned by Marshal for a value wider than its field,
+// unless the field is tagged overflow:truncate
+type OverflowError struct {
+	Value string
+	// the number of columns, or digits for packed numbers, available
+	Len int
+}
+
+func (e *OverflowError) Error() string {
+	return fmt.Sprintf("fixedwidth: value %q overflows %d columns", e.Value, e.Len)
+}
+
+// fieldError attaches the position of a field of struct type t to err. When
+// err already describes a field of a nested struct only the path and offset
+// are extended so the innermost field is reported
+func fieldError(err error, t reflect.Type, field reflect.StructField, offset int, width int, raw []byte) error {
+	if fe, ok := err.(*FieldError); ok {
+		if fe.Field == "" || strings.HasPrefix(fe.Field, "[") {
+			fe.Field = field.Name + fe.Field
+		} else {
+			fe.Field = field.Name + "." + fe.Field
+		}
+		fe.Struct = t.Name()
+		fe.Offset += offset
+		return fe
+	}
+	return &FieldError{Struct: t.Name(), Field: field.Name, Offset: offset, Len: width, Raw: raw, Err: err}
+}
+
+// elementError attaches the index i of an array or slice element to err, the
+// struct walk adds the name of the field in front
+func elementError(err error, i int, width int, raw []byte) error {
+	if fe, ok := err.(*FieldError); ok {
+		fe.Field = strings.TrimSuffix(fmt.Sprintf("[%d].%s", i, fe.Field), ".")
+		fe.Offset += i * width
+		return fe
+	}
+	return &FieldError{Field: fmt.Sprintf("[%d]", i), Offset: i * width, Len: width, Raw: raw, Err: err}
+}
@@ -0,0 +1,56 @@
+package fixedwidth
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+)
+
+type errorRec struct {
+	Name    string        `fixed:"len:5"`
+	Address nestedAddress `fixed:""`
+	Amounts [2]int        `fixed:"len:3"`
+}
+
+func TestUnmarshalFieldError(t *testing.T) {
+	dest := errorRec{}
+	err := Unmarshal([]byte("Bob  Main  00x70001002"), &dest)
+	var fe *FieldError
+	if !errors.As(err, &fe) {
+		t.Fatal("Expected a *FieldError got:", err)
+	}
+	if fe.Struct != "errorRec" || fe.Field != "Address.Zip" || fe.Offset != 11 || fe.Len != 5 || string(fe.Raw) != "00x70" {
+		t.Error("FieldError incorrectly expected: errorRec Address.Zip 11 5 00x70 got:", fe.Struct, fe.Field, fe.Offset, fe.Len, string(fe.Raw))
+	}
+	var ne *strconv.NumError
+	if !errors.As(err, &ne) {
+		t.Error("Expected the *strconv.NumError to be unwrapped got:", fe.Err)
+	}
+
+	err = Unmarshal([]byte("Bob  Main  00042001x02"), &dest)
+	if !errors.As(err, &fe) {
+		t.Fatal("Expected a *FieldError got:", err)
+	}
+	if fe.Field != "Amounts[1]" || fe.Offset != 19 || fe.Len != 3 || string(fe.Raw) != "x02" {
+		t.Error("FieldError incorrectly expected: Amounts[1] 19 3 x02 got:", fe.Field, fe.Offset, fe.Len, string(fe.Raw))
+	}
+}
+
+func TestMarshalFieldError(t *testing.T) {
+	bad := struct {
+		Name   string            `fixed:"len:4"`
+		Lookup map[string]string `fixed:"len:4"`
+	}{}
+	_, err := Marshal(bad)
+	var fe *FieldError
+	if !errors.As(err, &fe) {
+		t.Fatal("Expected a *FieldError got:", err)
+	}
+	if fe.Field != "Lookup" || fe.Offset != 4 || fe.Len != 4 || fe.Raw != nil {
+		t.Error("FieldError incorrectly expected: Lookup 4 4 nil got:", fe.Field, fe.Offset, fe.Len, fe.Raw)
+	}
+	var ute *UnsupportedTypeError
+	if !errors.As(err, &ute) || ute.Type.String() != "map[string]string" {
+		t.Error("Expected an *UnsupportedTypeError got:", err)
+	}
+}
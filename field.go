@@ -0,0 +1,402 @@
+package fixedwidth
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Layout is the column layout of a struct type. It is used by the
+// MarshalFixed and UnmarshalFixed methods generated by cmd/fixedgen, which
+// format every column with the same code as Marshal but without reflection
+type Layout struct {
+	fields []*Field
+	len    int
+	cs     *Charset
+	// the copies of the layout for other charsets by *Charset
+	charsets sync.Map
+}
+
+// Field is a single column of a Layout, the Put methods write a value into
+// its columns of a record and the Decode methods read it back. The bool the
+// Decode methods return is false when the column was blank
+type Field struct {
+	parent reflect.Type
+	field  reflect.StructField
+	tags   *fixedTags
+	offset int
+	width  int
+	// charset of the text columns, nil for UTF-8
+	cs *Charset
+}
+
+// NewLayout returns the layout of the struct type of v
+func NewLayout(v interface{}) (l *Layout, err error) {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		err = errors.New(fmt.Sprintf("layout of %T, expected a struct", v))
+		return
+	}
+	var fields []layoutField
+	if fields, err = structLayout(t); err != nil {
+		return
+	}
+	l = new(Layout)
+	pos := 0
+	for _, f := range fields {
+		if f.tags != nil && f.tags.DependsOn != "" {
+			err = errors.New(fmt.Sprintf("record length of %s is variable, field %s depends on %s", t, f.field.Name, f.tags.DependsOn))
+			return
+		}
+		if f.columns {
+			err = errors.New(fmt.Sprintf("record length of %s is variable, field %s is measured in characters", t, f.field.Name))
+			return
+		}
+		if f.offset() >= 0 {
+			pos = f.offset()
+		}
+		l.fields = append(l.fields, &Field{parent: t, field: f.field, tags: f.tags, offset: pos, width: f.width})
+		pos += f.width
+		if pos > l.len {
+			l.len = pos
+		}
+	}
+	return
+}
+
+// MustLayout is like NewLayout but panics on error or when the fields of the
+// layout are not names, in record order. Generated code calls it at init to
+// notice a struct that changed since the code was generated
+func MustLayout(v interface{}, names ...string) *Layout {
+	l, err := NewLayout(v)
+	if err != nil {
+		panic(err)
+	}
+	got := make([]string, len(l.fields))
+	for i, f := range l.fields {
+		got[i] = f.field.Name
+	}
+	if strings.Join(got, ",") != strings.Join(names, ",") {
+		panic(fmt.Sprintf("fixedwidth: fields of %T are %s, expected %s, regenerate", v, got, names))
+	}
+	return l
+}
+
+// Len is the length of a record
+func (l *Layout) Len() int {
+	return l.len
+}
+
+// Field returns the i'th column of the record
+func (l *Layout) Field(i int) *Field {
+	return l.fields[i]
+}
+
+// Blank returns a record of spaces for the Put methods to fill in
+func (l *Layout) Blank() []byte {
+	return bytes.Repeat([]byte{blankByte(l.cs)}, l.len)
+}
+
+// WithCharset returns the layout with its text columns in c, the way Marshal
+// and Unmarshal write and read them with a charset option. Columns with a
+// charset tag keep theirs
+func (l *Layout) WithCharset(c *Charset) *Layout {
+	if c == l.cs {
+		return l
+	}
+	if cl, ok := l.charsets.Load(c); ok {
+		return cl.(*Layout)
+	}
+	cl := &Layout{len: l.len, cs: c}
+	for _, f := range l.fields {
+		cf := *f
+		cf.cs = c
+		cl.fields = append(cl.fields, &cf)
+	}
+	v, _ := l.charsets.LoadOrStore(c, cl)
+	return v.(*Layout)
+}
+
+func (f *Field) put(rec []byte, b []byte) {
+	copy(rec[f.offset:f.offset+f.width], b)
+}
+
+// data returns the bytes of the column, a record that ends before it is an
+// ErrShortRecord
+func (f *Field) data(rec []byte) (d []byte, err error) {
+	if d, err = fieldData(rec, f.offset, f.width, DecodeOptions{}); err != nil {
+		err = f.wrap(err, d)
+	}
+	return
+}
+
+// wrap returns err as a *FieldError for the column, like Marshal and
+// Unmarshal do. raw is nil when marshaling
+func (f *Field) wrap(err error, raw []byte) error {
+	if err == nil {
+		return nil
+	}
+	return fieldError(err, f.parent, f.field, f.offset, f.width, raw)
+}
+
+// text returns the charset of a text column and its tags with the pad and
+// tokens in ISO-8859-1. cs is nil for columns written as they are, in UTF-8
+// or binary
+func (f *Field) text() (cs *Charset, tags *fixedTags, err error) {
+	tags = f.tags
+	cs = charsetOf(f.cs, f.tags)
+	if cs == nil || f.tags.Encoding == encodingPacked || leafKind(f.field.Type) == reflect.Slice {
+		return nil, tags, nil
+	}
+	tags, err = latin1Tags(f.tags)
+	return
+}
+
+// putText writes the ISO-8859-1 text b into the column, in charset cs
+func (f *Field) putText(rec []byte, b []byte, cs *Charset) {
+	if cs != nil {
+		cs.encodeLatin1(b)
+	}
+	f.put(rec, b)
+}
+
+// textData returns the column in ISO-8859-1 and the tags to decode it with
+func (f *Field) textData(rec []byte) (d []byte, cs *Charset, tags *fixedTags, err error) {
+	if d, err = f.data(rec); err != nil {
+		return
+	}
+	if cs, tags, err = f.text(); err != nil {
+		err = f.wrap(err, d)
+		return
+	}
+	if pcs := charsetOf(f.cs, f.tags); pcs != nil && f.tags.Encoding == encodingPacked {
+		d = packedBlank(d, pcs)
+	}
+	if cs != nil {
+		b := make([]byte, len(d))
+		copy(b, d)
+		cs.decodeLatin1(b)
+		d = b
+	}
+	return
+}
+
+// null reports whether a number column starts with NUL, Unmarshal leaves
+// such fields untouched
+func (f *Field) null(d []byte) bool {
+	return len(d) == 0 || (d[0] == 0x00 && f.tags.Encoding != encodingPacked)
+}
+
+// PutNil writes the column of a nil pointer
+func (f *Field) PutNil(rec []byte) {
+	cs, tags, err := f.text()
+	if err != nil {
+		cs, tags = nil, f.tags
+	}
+	if f.tags.Encoding == encodingPacked {
+		// a blank packed number is spaces of the charset
+		cs = charsetOf(f.cs, f.tags)
+	}
+	f.putText(rec, encodeNil(tags), cs)
+}
+
+// PutFiller writes a filler column
+func (f *Field) PutFiller(rec []byte) {
+	f.PutNil(rec)
+}
+
+func (f *Field) PutString(rec []byte, s string) (err error) {
+	cs, tags, err := f.text()
+	if err == nil && cs != nil {
+		s, err = toLatin1(s)
+	}
+	var b []byte
+	if err == nil {
+		b, err = encodeString(s, tags)
+	}
+	if err != nil {
+		return f.wrap(err, nil)
+	}
+	f.putText(rec, b, cs)
+	return
+}
+
+func (f *Field) PutInt(rec []byte, i int64) (err error) {
+	cs, tags, err := f.text()
+	var b []byte
+	if err == nil {
+		b, err = encodeInt(i, tags)
+	}
+	if err != nil {
+		return f.wrap(err, nil)
+	}
+	f.putText(rec, b, cs)
+	return
+}
+
+func (f *Field) PutUint(rec []byte, i uint64) (err error) {
+	cs, tags, err := f.text()
+	var b []byte
+	if err == nil {
+		b, err = encodeUint(i, tags)
+	}
+	if err != nil {
+		return f.wrap(err, nil)
+	}
+	f.putText(rec, b, cs)
+	return
+}
+
+func (f *Field) PutFloat(rec []byte, v float64, bitSize int) (err error) {
+	cs, tags, err := f.text()
+	var b []byte
+	if err == nil {
+		b, err = encodeFloat(v, bitSize, tags)
+	}
+	if err != nil {
+		return f.wrap(err, nil)
+	}
+	f.putText(rec, b, cs)
+	return
+}
+
+func (f *Field) PutBool(rec []byte, v bool) (err error) {
+	cs, tags, err := f.text()
+	var b []byte
+	if err == nil {
+		b, err = encodeBool(v, tags)
+	}
+	if err != nil {
+		return f.wrap(err, nil)
+	}
+	f.putText(rec, b, cs)
+	return
+}
+
+func (f *Field) PutTime(rec []byte, t time.Time) (err error) {
+	cs, tags, err := f.text()
+	var b []byte
+	if err == nil {
+		b, err = encodeTime(t, tags)
+	}
+	if err != nil {
+		return f.wrap(err, nil)
+	}
+	f.putText(rec, b, cs)
+	return
+}
+
+func (f *Field) PutBytes(rec []byte, v []byte) (err error) {
+	var b []byte
+	if b, err = encodeBytes(v, f.tags); err != nil {
+		return f.wrap(err, nil)
+	}
+	f.put(rec, b)
+	return
+}
+
+// PutValue writes any value the way Marshal does, generated code uses it
+// for the types it has no specialised method for
+func (f *Field) PutValue(rec []byte, v interface{}) (err error) {
+	out := &recordBuffer{blank: blankByte(f.cs)}
+	if err = marshalRecursive(out, EncodeOptions{Charset: f.cs}, &f.field, f.tags, reflect.ValueOf(v)); err != nil {
+		return f.wrap(err, nil)
+	}
+	f.put(rec, out.b)
+	return
+}
+
+func (f *Field) DecodeString(rec []byte) (s string, valid bool, err error) {
+	d, cs, tags, err := f.textData(rec)
+	if err != nil {
+		return
+	}
+	if s, valid = decodeString(d, tags); cs != nil {
+		s = fromLatin1([]byte(s))
+	}
+	return
+}
+
+// DecodeInt parses an integer of bitSize bits, 0 is the size of an int
+func (f *Field) DecodeInt(rec []byte, bitSize int) (v int64, valid bool, err error) {
+	d, _, tags, err := f.textData(rec)
+	if err != nil || f.null(d) {
+		return
+	}
+	if bitSize == 0 {
+		bitSize = strconv.IntSize
+	}
+	v, valid, err = decodeInt(d, tags, bitSize)
+	err = f.wrap(err, d)
+	return
+}
+
+// DecodeUint parses an unsigned integer of bitSize bits, 0 is the size of a uint
+func (f *Field) DecodeUint(rec []byte, bitSize int) (v uint64, valid bool, err error) {
+	d, _, tags, err := f.textData(rec)
+	if err != nil || f.null(d) {
+		return
+	}
+	if bitSize == 0 {
+		bitSize = strconv.IntSize
+	}
+	v, valid, err = decodeUint(d, tags, bitSize)
+	err = f.wrap(err, d)
+	return
+}
+
+func (f *Field) DecodeFloat(rec []byte, bitSize int) (v float64, valid bool, err error) {
+	d, _, tags, err := f.textData(rec)
+	if err != nil || f.null(d) {
+		return
+	}
+	v, valid, err = decodeFloat(d, tags, bitSize)
+	err = f.wrap(err, d)
+	return
+}
+
+func (f *Field) DecodeBool(rec []byte) (v bool, valid bool, err error) {
+	d, _, tags, err := f.textData(rec)
+	if err != nil {
+		return
+	}
+	v, valid, err = decodeBool(d, tags)
+	err = f.wrap(err, d)
+	return
+}
+
+func (f *Field) DecodeTime(rec []byte) (t time.Time, valid bool, err error) {
+	d, _, tags, err := f.textData(rec)
+	if err != nil {
+		return
+	}
+	t, valid, err = decodeTime(d, tags)
+	err = f.wrap(err, d)
+	return
+}
+
+func (f *Field) DecodeBytes(rec []byte) (v []byte, valid bool, err error) {
+	if v, err = f.data(rec); err == nil {
+		valid = true
+	}
+	return
+}
+
+// DecodeValue decodes the column into the value ptr points to the way
+// Unmarshal does
+func (f *Field) DecodeValue(rec []byte, ptr interface{}) (err error) {
+	var d []byte
+	if d, err = f.data(rec); err != nil {
+		return
+	}
+	_, err = unmarshalRecursive(d, DecodeOptions{Charset: f.cs}, &f.field, f.tags, reflect.ValueOf(ptr).Elem())
+	return f.wrap(err, d)
+}
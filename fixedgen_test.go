@@ -0,0 +1,104 @@
+package fixedwidth
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+//go:generate go run ./cmd/fixedgen -type genRecord,genNested
+
+type genRecord struct {
+	Name    string        `fixed:"len:6"`
+	Number  int           `fixed:"len:4,pad: "`
+	Hex     uint16        `fixed:"len:4,base:16"`
+	Amount  float64       `fixed:"len:9,decimals:2,implied:true,sign:trailing"`
+	Flag    bool          `fixed:"len:1,true:Y,false:N"`
+	_       struct{}      `fixed:"-,len:2"`
+	Date    time.Time     `fixed:"len:8,format:01022006"`
+	Count   *int32        `fixed:"len:3"`
+	Note    *string       `fixed:"len:4"`
+	Code    []byte        `fixed:"len:2"`
+	Address nestedAddress `fixed:""`
+	Zoned   int64         `fixed:"pos:60-65,encoding:zoned"`
+	Skipped string
+}
+
+// genRecordPlain has the fields of genRecord without the generated methods
+type genRecordPlain genRecord
+
+// genNested has an untagged nested struct, laid out inline, and an
+// unexported field Marshal skips
+type genNested struct {
+	ID      int `fixed:"len:2"`
+	Address nestedAddress
+	note    string `fixed:"len:2"`
+	Name    string `fixed:"len:3"`
+}
+
+type genNestedPlain genNested
+
+func TestFixedgenMatchesMarshal(t *testing.T) {
+	count := int32(7)
+	src := genRecord{
+		Name:    "Bob",
+		Number:  -42,
+		Hex:     255,
+		Amount:  -1234.5,
+		Flag:    true,
+		Date:    time.Date(1990, 11, 16, 0, 0, 0, 0, time.UTC),
+		Count:   &count,
+		Code:    []byte("AB"),
+		Address: nestedAddress{"Main", 42},
+		Zoned:   -120,
+		Skipped: "ignored",
+	}
+	data, err := Marshal(genRecordPlain(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := src.MarshalFixed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Compare(res, data) != 0 {
+		t.Errorf("Generated marshal incorrectly expected: '%s' got: '%s'", data, res)
+	}
+
+	var reflected genRecordPlain
+	if err := Unmarshal(data, &reflected); err != nil {
+		t.Fatal(err)
+	}
+	var generated genRecord
+	if err := generated.UnmarshalFixed(data); err != nil {
+		t.Fatal(err)
+	}
+	if generated.Name != reflected.Name || generated.Number != reflected.Number || generated.Hex != reflected.Hex ||
+		generated.Amount != reflected.Amount || generated.Flag != reflected.Flag || !generated.Date.Equal(reflected.Date) ||
+		*generated.Count != *reflected.Count || generated.Note != nil || reflected.Note != nil ||
+		string(generated.Code) != string(reflected.Code) || generated.Address != reflected.Address || generated.Zoned != reflected.Zoned {
+		t.Errorf("Generated unmarshal incorrectly expected: %+v got: %+v", reflected, generated)
+	}
+}
+
+func TestFixedgenNested(t *testing.T) {
+	src := genNested{ID: 7, Address: nestedAddress{"Main", 42}, note: "xx", Name: "Bob"}
+	data, err := Marshal(genNestedPlain(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := src.MarshalFixed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Compare(res, data) != 0 {
+		t.Errorf("Generated marshal incorrectly expected: '%s' got: '%s'", data, res)
+	}
+	var generated genNested
+	if err := generated.UnmarshalFixed(data); err != nil {
+		t.Fatal(err)
+	}
+	if generated.ID != 7 || generated.Address != src.Address || generated.note != "" || generated.Name != "Bob" {
+		t.Errorf("Generated unmarshal incorrectly expected: {7 %+v  Bob} got: %+v", src.Address, generated)
+	}
+}
@@ -0,0 +1,228 @@
+// Code generated by fixedgen; DO NOT EDIT.
+
+package fixedwidth
+
+var fixedLayoutGenRecord = MustLayout(genRecord{}, "Name", "Number", "Hex", "Amount", "Flag", "_", "Date", "Count", "Note", "Code", "Address", "Zoned")
+
+// MarshalFixed implements Marshaler
+func (r genRecord) MarshalFixed() ([]byte, error) {
+	return r.marshalFixed(fixedLayoutGenRecord)
+}
+
+// MarshalFixedCharset implements CharsetMarshaler
+func (r genRecord) MarshalFixedCharset(c *Charset) ([]byte, error) {
+	return r.marshalFixed(fixedLayoutGenRecord.WithCharset(c))
+}
+
+func (r genRecord) marshalFixed(l *Layout) ([]byte, error) {
+	rec := l.Blank()
+	if err := l.Field(0).PutString(rec, string(r.Name)); err != nil {
+		return nil, err
+	}
+	if err := l.Field(1).PutInt(rec, int64(r.Number)); err != nil {
+		return nil, err
+	}
+	if err := l.Field(2).PutUint(rec, uint64(r.Hex)); err != nil {
+		return nil, err
+	}
+	if err := l.Field(3).PutFloat(rec, float64(r.Amount), 64); err != nil {
+		return nil, err
+	}
+	if err := l.Field(4).PutBool(rec, bool(r.Flag)); err != nil {
+		return nil, err
+	}
+	l.Field(5).PutFiller(rec)
+	if err := l.Field(6).PutTime(rec, r.Date); err != nil {
+		return nil, err
+	}
+	if r.Count == nil {
+		l.Field(7).PutNil(rec)
+	} else if err := l.Field(7).PutInt(rec, int64(*r.Count)); err != nil {
+		return nil, err
+	}
+	if r.Note == nil {
+		l.Field(8).PutNil(rec)
+	} else if err := l.Field(8).PutString(rec, string(*r.Note)); err != nil {
+		return nil, err
+	}
+	if err := l.Field(9).PutBytes(rec, r.Code); err != nil {
+		return nil, err
+	}
+	if err := l.Field(10).PutValue(rec, r.Address); err != nil {
+		return nil, err
+	}
+	if err := l.Field(11).PutInt(rec, int64(r.Zoned)); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// UnmarshalFixed implements Unmarshaler
+func (r *genRecord) UnmarshalFixed(data []byte) error {
+	return r.unmarshalFixed(data, fixedLayoutGenRecord)
+}
+
+// UnmarshalFixedCharset implements CharsetUnmarshaler
+func (r *genRecord) UnmarshalFixedCharset(data []byte, c *Charset) error {
+	return r.unmarshalFixed(data, fixedLayoutGenRecord.WithCharset(c))
+}
+
+func (r *genRecord) unmarshalFixed(data []byte, l *Layout) error {
+	{
+		v, _, err := l.Field(0).DecodeString(data)
+		if err != nil {
+			return err
+		}
+		r.Name = string(v)
+	}
+	{
+		v, ok, err := l.Field(1).DecodeInt(data, 0)
+		if err != nil {
+			return err
+		}
+		if ok {
+			r.Number = int(v)
+		}
+	}
+	{
+		v, ok, err := l.Field(2).DecodeUint(data, 16)
+		if err != nil {
+			return err
+		}
+		if ok {
+			r.Hex = uint16(v)
+		}
+	}
+	{
+		v, ok, err := l.Field(3).DecodeFloat(data, 64)
+		if err != nil {
+			return err
+		}
+		if ok {
+			r.Amount = float64(v)
+		}
+	}
+	{
+		v, ok, err := l.Field(4).DecodeBool(data)
+		if err != nil {
+			return err
+		}
+		if ok {
+			r.Flag = bool(v)
+		}
+	}
+	{
+		v, ok, err := l.Field(6).DecodeTime(data)
+		if err != nil {
+			return err
+		}
+		if ok {
+			r.Date = v
+		}
+	}
+	{
+		v, ok, err := l.Field(7).DecodeInt(data, 32)
+		if err != nil {
+			return err
+		}
+		if r.Count != nil {
+			if ok {
+				*r.Count = int32(v)
+			}
+		} else if ok {
+			x := int32(v)
+			r.Count = &x
+		}
+	}
+	{
+		v, ok, err := l.Field(8).DecodeString(data)
+		if err != nil {
+			return err
+		}
+		if r.Note != nil {
+			*r.Note = string(v)
+		} else if ok {
+			x := string(v)
+			r.Note = &x
+		}
+	}
+	{
+		v, _, err := l.Field(9).DecodeBytes(data)
+		if err != nil {
+			return err
+		}
+		r.Code = v
+	}
+	if err := l.Field(10).DecodeValue(data, &r.Address); err != nil {
+		return err
+	}
+	{
+		v, ok, err := l.Field(11).DecodeInt(data, 64)
+		if err != nil {
+			return err
+		}
+		if ok {
+			r.Zoned = int64(v)
+		}
+	}
+	return nil
+}
+
+var fixedLayoutGenNested = MustLayout(genNested{}, "ID", "Address", "Name")
+
+// MarshalFixed implements Marshaler
+func (r genNested) MarshalFixed() ([]byte, error) {
+	return r.marshalFixed(fixedLayoutGenNested)
+}
+
+// MarshalFixedCharset implements CharsetMarshaler
+func (r genNested) MarshalFixedCharset(c *Charset) ([]byte, error) {
+	return r.marshalFixed(fixedLayoutGenNested.WithCharset(c))
+}
+
+func (r genNested) marshalFixed(l *Layout) ([]byte, error) {
+	rec := l.Blank()
+	if err := l.Field(0).PutInt(rec, int64(r.ID)); err != nil {
+		return nil, err
+	}
+	if err := l.Field(1).PutValue(rec, r.Address); err != nil {
+		return nil, err
+	}
+	if err := l.Field(2).PutString(rec, string(r.Name)); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// UnmarshalFixed implements Unmarshaler
+func (r *genNested) UnmarshalFixed(data []byte) error {
+	return r.unmarshalFixed(data, fixedLayoutGenNested)
+}
+
+// UnmarshalFixedCharset implements CharsetUnmarshaler
+func (r *genNested) UnmarshalFixedCharset(data []byte, c *Charset) error {
+	return r.unmarshalFixed(data, fixedLayoutGenNested.WithCharset(c))
+}
+
+func (r *genNested) unmarshalFixed(data []byte, l *Layout) error {
+	{
+		v, ok, err := l.Field(0).DecodeInt(data, 0)
+		if err != nil {
+			return err
+		}
+		if ok {
+			r.ID = int(v)
+		}
+	}
+	if err := l.Field(1).DecodeValue(data, &r.Address); err != nil {
+		return err
+	}
+	{
+		v, _, err := l.Field(2).DecodeString(data)
+		if err != nil {
+			return err
+		}
+		r.Name = string(v)
+	}
+	return nil
+}
@@ -0,0 +1,325 @@
+package fixedwidth
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// layoutField is a struct field that takes part in the fixed width record
+type layoutField struct {
+	field reflect.StructField
+	// nil for untagged nested structs
+	tags  *fixedTags
+	width int
+	// measured in characters rather than bytes, a string with a width tag
+	// or a nested struct with such fields
+	columns bool
+}
+
+// offset is where the field starts in its struct, -1 when it directly
+// follows the previous field
+func (f layoutField) offset() int {
+	if f.tags == nil {
+		return -1
+	}
+	return f.tags.Offset
+}
+
+// layoutCache holds the []layoutField of every struct type seen so far, tags
+// are only parsed once per type
+var layoutCache sync.Map
+
+// structLayout lists the fields of a struct type that make up its record,
+// tagged fields, nested structs and fields promoted from embedded structs.
+// The result is cached and shared, it must not be modified
+func structLayout(t reflect.Type) (fields []layoutField, err error) {
+	return layoutOf(t, nil)
+}
+
+// layoutOf is structLayout for a type met while building the layouts of the
+// types in building, which are not cached yet
+func layoutOf(t reflect.Type, building []reflect.Type) (fields []layoutField, err error) {
+	if f, ok := layoutCache.Load(t); ok {
+		return f.([]layoutField), nil
+	}
+	if fields, err = buildLayout(t, append(building, t)); err != nil {
+		return
+	}
+	layoutCache.Store(t, fields)
+	return
+}
+
+func buildLayout(t reflect.Type, building []reflect.Type) (fields []layoutField, err error) {
+	for i := 0; i < t.NumField(); i += 1 {
+		field := t.Field(i)
+		if _, tagged := field.Tag.Lookup(tagName); field.Anonymous && !tagged {
+			if err = appendEmbedded(&fields, field, building); err != nil {
+				return
+			}
+			continue
+		}
+		var tagz *fixedTags
+		if tagz, err = parseTags(field, leafKind(field.Type)); err != nil {
+			return
+		}
+		// unexported fields can only be fillers, they are never accessed
+		if field.PkgPath != "" && (tagz == nil || !tagz.Filler) {
+			continue
+		}
+		if tagz != nil {
+			columns := tagz.Width != widthBytes || columnsIn(field.Type, building)
+			if columns && (tagz.Count > 0 || tagz.DependsOn != "") {
+				err = errors.New(fmt.Sprintf("field %s repeats a struct with fields measured in characters", field.Name))
+				return
+			}
+			fields = append(fields, layoutField{field: field, tags: tagz, width: tagz.width(), columns: columns})
+		} else if !field.Anonymous && field.Type.Kind() == reflect.Struct && inlineStruct(field.Type) != nil {
+			var l int
+			if l, err = recordLen(field.Type); err != nil {
+				return
+			}
+			fields = append(fields, layoutField{field: field, width: l, columns: columnsIn(field.Type, building)})
+		} else if !field.Anonymous && field.Type.Kind() == reflect.Struct && field.Type != timeType {
+			// a struct with its own marshaler, its width is unknown
+			err = errors.New(fmt.Sprintf("missing len tag on field %s, %s has its own marshaler", field.Name, field.Type))
+			return
+		} else if !field.Anonymous && repeatsStruct(field.Type) {
+			// the elements are not laid out inline, their width is unknown
+			err = errors.New(fmt.Sprintf("missing len tag on field %s, %s repeats a struct", field.Name, field.Type))
+			return
+		}
+	}
+	err = checkOverlap(t, fields)
+	return
+}
+
+// checkOverlap makes sure no two fields of a struct share a column. The
+// columns after a variable length field are unknown, they are not checked
+func checkOverlap(t reflect.Type, fields []layoutField) error {
+	type span struct {
+		name       string
+		start, end int
+	}
+	var spans []span
+	pos := 0
+	for _, f := range fields {
+		if f.tags != nil && f.tags.DependsOn != "" {
+			return nil
+		}
+		if f.offset() >= 0 {
+			pos = f.offset()
+		}
+		if f.width == 0 {
+			continue
+		}
+		s := span{f.field.Name, pos, pos + f.width}
+		for _, o := range spans {
+			if s.start < o.end && o.start < s.end {
+				return errors.New(fmt.Sprintf("field %s at %d-%d overlaps field %s at %d-%d of %s", s.name, s.start+1, s.end, o.name, o.start+1, o.end, t))
+			}
+		}
+		spans = append(spans, s)
+		pos += f.width
+	}
+	return nil
+}
+
+// appendEmbedded promotes the fields of an untagged embedded struct the way
+// encoding/json does, they are laid out inline as if declared in the outer
+// struct. Pointers to unexported struct types are ignored as they can not be
+// allocated
+func appendEmbedded(fields *[]layoutField, field reflect.StructField, building []reflect.Type) (err error) {
+	t := field.Type
+	if t.Kind() == reflect.Ptr {
+		if field.PkgPath != "" {
+			return
+		}
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || inlineStruct(t) == nil {
+		return
+	}
+	var embedded []layoutField
+	if embedded, err = layoutOf(t, building); err != nil {
+		return
+	}
+	for _, e := range embedded {
+		e.field.Index = append([]int{field.Index[0]}, e.field.Index...)
+		*fields = append(*fields, e)
+	}
+	return
+}
+
+// fieldByIndex returns the nested field of v at index, nil embedded pointers
+// on the way are allocated when alloc is set, otherwise ok is false
+func fieldByIndex(v reflect.Value, index []int, alloc bool) (f reflect.Value, ok bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc {
+					return
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// recordLen is the length of the record of a struct type, up to the end of
+// its last column. Nested structs without a len tag count with the length of
+// their own fields
+func recordLen(t reflect.Type) (l int, err error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	var fields []layoutField
+	if fields, err = structLayout(t); err != nil {
+		return
+	}
+	pos := 0
+	for _, f := range fields {
+		if f.tags != nil && f.tags.DependsOn != "" {
+			err = errors.New(fmt.Sprintf("record length of %s is variable, field %s depends on %s", t, f.field.Name, f.tags.DependsOn))
+			return
+		}
+		if f.offset() >= 0 {
+			pos = f.offset()
+		}
+		pos += f.width
+		if pos > l {
+			l = pos
+		}
+	}
+	return
+}
+
+// inlineStruct returns the struct type behind t, looking through pointers,
+// arrays and slices, when its fields are laid out inline in the record.
+// time.Time and types with their own (un)marshaler are not
+func inlineStruct(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Array || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == reflect.TypeOf(time.Time{}) {
+		return nil
+	}
+	ptr := reflect.PtrTo(t)
+	if t.Implements(marshalerType) || ptr.Implements(marshalerType) || ptr.Implements(unmarshalerType) {
+		return nil
+	}
+	return t
+}
+
+// repeatsStruct reports whether t is an array or slice of structs other than
+// time.Time, or of pointers to them
+func repeatsStruct(t reflect.Type) bool {
+	if t.Kind() != reflect.Array && t.Kind() != reflect.Slice {
+		return false
+	}
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Array || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && t != timeType
+}
+
+// leafKind is the kind of the values the tags of a field of type t format,
+// pointers, arrays and slices are looked through except for []byte
+func leafKind(t reflect.Type) reflect.Kind {
+	for {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Array:
+			t = t.Elem()
+		case reflect.Slice:
+			if t.Elem().Kind() == reflect.Uint8 {
+				return reflect.Slice
+			}
+			t = t.Elem()
+		default:
+			return t.Kind()
+		}
+	}
+}
+
+var marshalerType = reflect.TypeOf((*Marshaler)(nil)).Elem()
+var unmarshalerType = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+
+// dependentCount reads the number of elements of a slice field from the
+// counter field it depends on, the counter has to be one of the earlier fields
+func dependentCount(parent reflect.Value, earlier []layoutField, fieldName string, name string) (count int, err error) {
+	var v reflect.Value
+	found := false
+	for _, f := range earlier {
+		if f.field.Name == name {
+			v, _ = fieldByIndex(parent, f.field.Index, false)
+			found = true
+		}
+	}
+	if !found {
+		err = errors.New(fmt.Sprintf("field %s depends on %s which is not an earlier field of %s", fieldName, name, parent.Type()))
+		return
+	}
+	if !v.IsValid() {
+		// promoted from a nil embedded pointer
+		return
+	}
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Int() < 0 {
+			err = errors.New(fmt.Sprintf("counter %s is negative", name))
+			return
+		}
+		count = int(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		count = int(v.Uint())
+	default:
+		err = errors.New(fmt.Sprintf("counter %s is not an integer", name))
+	}
+	return
+}
+
+// recordBuffer assembles a record from fields that may be written out of
+// order, columns that are skipped are filled with blank, a space by default
+type recordBuffer struct {
+	b     []byte
+	pos   int
+	blank byte
+}
+
+// seek moves the write position to the zero based column pos
+func (r *recordBuffer) seek(pos int) {
+	r.grow(pos)
+	r.pos = pos
+}
+
+func (r *recordBuffer) grow(l int) {
+	if l > len(r.b) {
+		blank := r.blank
+		if blank == 0 {
+			blank = defaultPadString[0]
+		}
+		r.b = append(r.b, bytes.Repeat([]byte{blank}, l-len(r.b))...)
+	}
+}
+
+func (r *recordBuffer) Write(p []byte) (n int, err error) {
+	r.grow(r.pos + len(p))
+	n = copy(r.b[r.pos:], p)
+	r.pos += n
+	return
+}
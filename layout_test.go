@@ -0,0 +1,134 @@
+package fixedwidth
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type layoutRec struct {
+	Date   time.Time `fixed:"len:8,format:01022006"`
+	Number int       `fixed:"len:3"`
+	String string    `fixed:"len:5"`
+	Amount float64   `fixed:"len:9,decimals:2,implied:true"`
+}
+
+func TestStructLayoutCached(t *testing.T) {
+	first, err := structLayout(reflect.TypeOf(layoutRec{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := structLayout(reflect.TypeOf(layoutRec{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 4 || &first[0] != &second[0] {
+		t.Error("Layout was not cached")
+	}
+	if first[3].tags.Pad != defaultPadInt || first[3].width != 9 {
+		t.Error("Layout tags incorrectly expected pad 0 width 9 got:", first[3].tags.Pad, first[3].width)
+	}
+}
+
+func TestStructLayoutConcurrent(t *testing.T) {
+	data := []byte("11161990123Hello000123456")
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i += 1 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var dest layoutRec
+			if err := Unmarshal(data, &dest); err != nil {
+				t.Error(err)
+			}
+			res, err := Marshal(dest)
+			if err != nil {
+				t.Error(err)
+			}
+			if string(res) != string(data) {
+				t.Error("Concurrent round trip incorrectly expected:", string(data), "got:", string(res))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkMarshal(b *testing.B) {
+	src := layoutRec{Date: time.Now(), Number: 123, String: "Hello", Amount: 1234.56}
+	for i := 0; i < b.N; i += 1 {
+		if _, err := Marshal(src); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnmarshal(b *testing.B) {
+	data := []byte("11161990123Hello000123456")
+	var dest layoutRec
+	for i := 0; i < b.N; i += 1 {
+		if err := Unmarshal(data, &dest); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestStructLayoutMarshalerNeedsLen(t *testing.T) {
+	type rec struct {
+		A   string `fixed:"len:2"`
+		Gen genRecord
+		B   string `fixed:"len:2"`
+	}
+	if _, err := Marshal(rec{A: "xx", B: "yy"}); err == nil {
+		t.Error("expected a missing len tag error for an untagged field with its own marshaler")
+	}
+	type tagged struct {
+		A   string    `fixed:"len:2"`
+		Gen genRecord `fixed:"len:68"`
+	}
+	if _, err := Marshal(tagged{A: "xx"}); err != nil {
+		t.Error("unexpected error for a tagged field with its own marshaler:", err)
+	}
+}
+
+func TestStructLayoutArrayNeedsLen(t *testing.T) {
+	type item struct {
+		Code string `fixed:"len:2"`
+	}
+	type rec struct {
+		A     string `fixed:"len:2"`
+		Items [2]item
+	}
+	if _, err := Marshal(rec{A: "xx"}); err == nil {
+		t.Error("expected a missing len tag error for an untagged array of structs")
+	}
+	type slice struct {
+		A     string `fixed:"len:2"`
+		Items []*item
+	}
+	if err := Unmarshal([]byte("xxab"), &slice{}); err == nil {
+		t.Error("expected a missing len tag error for an untagged slice of structs")
+	}
+	type times struct {
+		A    string `fixed:"len:2"`
+		Seen []time.Time
+	}
+	if _, err := Marshal(times{A: "xx"}); err != nil {
+		t.Error("unexpected error for an untagged slice of time.Time:", err)
+	}
+}
+
+type layoutNode struct {
+	Name string      `fixed:"len:3"`
+	Next *layoutNode `fixed:"len:6"`
+}
+
+func TestStructLayoutRecursive(t *testing.T) {
+	res, err := Marshal(layoutNode{Name: "abc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res) != "abc      " {
+		t.Error("Recursive struct encoded incorrectly expected: 'abc      ' got:", "'"+string(res)+"'")
+	}
+}
@@ -15,22 +15,39 @@ type Marshaler interface {
 }
 
 func Marshal(in interface{}) ([]byte, error) {
+	return MarshalWithOptions(in, EncodeOptions{})
+}
+
+// MarshalWithOptions is like Marshal but with non default options
+func MarshalWithOptions(in interface{}, opts EncodeOptions) ([]byte, error) {
 	buf := bytes.Buffer{}
-	err := marshalRecursive(&buf, nil, reflect.ValueOf(in))
+	err := marshalRecursive(&buf, opts, nil, nil, reflect.ValueOf(in))
 	if err != nil {
 		return nil, err
 	}
 	return buf.Bytes(), err
 }
-func marshalRecursive(w io.Writer, field *reflect.StructField, val reflect.Value) (err error) {
-	var tag *fixedTags
-	if field != nil {
-		tag, err = parseTags(*field, val.Kind())
-		if err != nil {
+
+// marshalRecursive writes val to w, tag holds the parsed tags of the struct
+// field val belongs to and is nil for the top level value
+func marshalRecursive(w io.Writer, opts EncodeOptions, field *reflect.StructField, tag *fixedTags, val reflect.Value) (err error) {
+	// text is formatted in ISO-8859-1, one byte per character, and
+	// transcoded as it is written. Nil pointers are blank text unless the
+	// field is a []byte
+	if cs := charsetOf(opts.Charset, tag); cs != nil && (textValue(val, tag) || nilText(val, tag)) {
+		if tag, err = latin1Tags(tag); err != nil {
 			return
 		}
+		if val.Kind() == reflect.String {
+			var s string
+			if s, err = toLatin1(val.String()); err != nil {
+				return
+			}
+			val = reflect.ValueOf(s)
+		}
+		w = &transcoder{w: w, cs: cs}
+		opts.Charset = nil
 	}
-
 	switch val.Kind() {
 	case reflect.Ptr:
 		// To get the actual value of the original we have to call Elem()
@@ -40,26 +57,29 @@ func marshalRecursive(w io.Writer, field *reflect.StructField, val reflect.Value
 
 		// Check if the pointer is nil
 		if unwrapped.IsValid() {
-			return marshalRecursive(w, field, unwrapped)
+			return marshalRecursive(w, opts, field, tag, unwrapped)
 		} else {
-			newInst := reflect.New(val.Type().Elem())
-			tag, err = parseTags(*field, newInst.Elem().Kind())
-			if err != nil {
-				return
-			}
-			strInt := alignAndPad2Len(tag.Align,"", tag.Pad, tag.Len)
-			_, err = w.Write(strInt)
+			_, err = w.Write(encodeNil(tag))
 			return
 		}
-		return marshalRecursive(w, field, unwrapped)
 	case reflect.Interface:
 		unwrapped := val.Elem()
-		return marshalRecursive(w, field, unwrapped)
+		// the defaults of the tags depend on the dynamic type
+		if field != nil && unwrapped.IsValid() {
+			if tag, err = parseTags(*field, leafKind(unwrapped.Type())); err != nil {
+				return
+			}
+		}
+		return marshalRecursive(w, opts, field, tag, unwrapped)
 	case reflect.Struct:
 		//custom marshaler
 		if _, ok := val.Interface().(Marshaler); ok {
 			var b []byte
-			b, err = val.Interface().(Marshaler).MarshalFixed()
+			if m, ok := val.Interface().(CharsetMarshaler); ok && charsetOf(opts.Charset, tag) != nil {
+				b, err = m.MarshalFixedCharset(charsetOf(opts.Charset, tag))
+			} else {
+				b, err = val.Interface().(Marshaler).MarshalFixed()
+			}
 			if err != nil {
 				return
 			}
@@ -69,56 +89,275 @@ func marshalRecursive(w io.Writer, field *reflect.StructField, val reflect.Value
 
 		// struct type exceptions
 		if t, ok := val.Interface().(time.Time); ok {
-			if tag.Format != "" {
-				w.Write([]byte(t.Format(tag.Format)))
-				return
-			} else {
-				err = errors.New("no date format specified")
+			var b []byte
+			if b, err = encodeTime(t, tag); err != nil {
 				return
 			}
+			_, err = w.Write(b)
+			return
 		}
 
-		// else walk the fields
-		tipe := reflect.TypeOf(val.Interface())
-		for i := 0; i < val.NumField(); i += 1 {
-			field := tipe.Field(i)
-			tag := field.Tag.Get(tagName)
-			if tag == "" {
+		// else walk the fields, a nested struct with a len tag is padded to it.
+		// A charset tag on the struct is the charset of its fields
+		opts.Charset = charsetOf(opts.Charset, tag)
+		out := &recordBuffer{blank: blankByte(opts.Charset)}
+		var fields []layoutField
+		if fields, err = structLayout(val.Type()); err != nil {
+			return
+		}
+		// fields measured in characters move the ones after them along by
+		// the extra bytes they take up
+		extra := 0
+		for k, f := range fields {
+			field := f.field
+			if f.offset() >= 0 {
+				out.seek(f.offset() + extra)
+			}
+			if f.tags != nil && f.tags.Filler {
+				if err = marshalFiller(out, opts, f.tags, f.width); err != nil {
+					return
+				}
 				continue
 			}
-			if err = marshalRecursive(w, &field, val.Field(i)); err != nil {
+			fv, ok := fieldByIndex(val, field.Index, false)
+			if !ok && f.tags == nil {
+				// an untagged nested struct promoted from a nil embedded
+				// pointer, there are no tags to write it with
+				if _, err = out.Write(bytes.Repeat([]byte{blankByte(opts.Charset)}, f.width)); err != nil {
+					return
+				}
+				continue
+			} else if !ok {
+				// promoted from a nil embedded pointer, write it blank
+				fv = reflect.Zero(reflect.PtrTo(field.Type))
+			}
+			start := out.pos
+			if f.tags != nil && f.tags.DependsOn != "" {
+				if err = marshalDependent(out, opts, &field, f.tags, fv, val, fields[:k]); err != nil {
+					err = fieldError(err, val.Type(), field, start, out.pos-start, nil)
+					return
+				}
+				continue
+			}
+			if err = marshalRecursive(out, opts, &field, f.tags, fv); err != nil {
+				err = fieldError(err, val.Type(), field, start, f.width, nil)
 				return
 			}
-
+			if f.columns {
+				extra += out.pos - start - f.width
+			}
+		}
+		if tag != nil {
+			if err = checkOverflow(string(out.b), len(out.b)-extra, tag.Len, tag); err != nil {
+				return
+			}
+			pad := tag.Pad
+			if opts.Charset != nil {
+				var b []byte
+				if b, err = opts.Charset.Encode(pad); err != nil {
+					return
+				}
+				pad = string(b)
+			}
+			_, err = w.Write(alignAndPad2Len(tag.Align, string(out.b), pad, tag.Len+extra))
+		} else {
+			_, err = w.Write(out.b)
 		}
 	case reflect.String:
-		strInt := alignAndPad2Len(tag.Align,val.String(), tag.Pad, tag.Len)
+		var b []byte
+		if b, err = encodeString(val.String(), tag); err != nil {
+			return
+		}
+		_, err = w.Write(b)
+		return
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var strInt []byte
+		if strInt, err = encodeInt(val.Int(), tag); err != nil {
+			return
+		}
 		_, err = w.Write(strInt)
 		return
-	case reflect.Int, reflect.Int32, reflect.Int64:
-		strInt := alignAndPad2Len(tag.Align,strconv.FormatInt(val.Int(), tag.Base), tag.Pad, tag.Len)
-
-		// always do upper case for hex and stuff
-		if tag.Base != 10 {
-			strInt = bytes.ToUpper(strInt)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var strInt []byte
+		if strInt, err = encodeUint(val.Uint(), tag); err != nil {
+			return
 		}
 		_, err = w.Write(strInt)
 		return
+	case reflect.Bool:
+		var b []byte
+		if b, err = encodeBool(val.Bool(), tag); err != nil {
+			return
+		}
+		_, err = w.Write(b)
+		return
+	case reflect.Float32, reflect.Float64:
+		var strFloat []byte
+		if strFloat, err = encodeFloat(val.Float(), val.Type().Bits(), tag); err != nil {
+			return
+		}
+		_, err = w.Write(strFloat)
+		return
 	case reflect.Slice:
 		if _, ok := val.Interface().([]byte); ok {
-			b := bytes.Repeat([]byte(tag.Pad), tag.Len)
-			copy(b, val.Bytes())
+			var b []byte
+			if b, err = encodeBytes(val.Bytes(), tag); err != nil {
+				return
+			}
 			_, err = w.Write(b)
 			return
-		} else {
-			err = errors.New(fmt.Sprintf("Unknown slice type %s", val.Kind()))
+		}
+		if tag.Count == 0 {
+			err = errors.New(fmt.Sprintf("slice field %s requires a count tag", field.Name))
 			return
 		}
+		if val.Len() > tag.Count {
+			err = errors.New(fmt.Sprintf("slice field %s has %d elements, count is %d", field.Name, val.Len(), tag.Count))
+			return
+		}
+		for i := 0; i < tag.Count; i += 1 {
+			elem := reflect.Zero(val.Type().Elem())
+			if i < val.Len() {
+				elem = val.Index(i)
+			}
+			if err = marshalRecursive(w, opts, field, tag, elem); err != nil {
+				err = elementError(err, i, tag.Len, nil)
+				return
+			}
+		}
+	case reflect.Array:
+		for i := 0; i < val.Len(); i += 1 {
+			if err = marshalRecursive(w, opts, field, tag, val.Index(i)); err != nil {
+				err = elementError(err, i, tag.Len, nil)
+				return
+			}
+		}
 
+	case reflect.Invalid:
+		// a nil interface, blank when it is a field
+		if tag == nil {
+			err = &UnsupportedTypeError{}
+			return
+		}
+		if cs := charsetOf(opts.Charset, tag); cs != nil {
+			w = &transcoder{w: w, cs: cs}
+		}
+		_, err = w.Write(encodeNil(tag))
+		return
 	default:
-		err = errors.New("Unknown type: " + val.Kind().String())
+		err = &UnsupportedTypeError{Type: val.Type()}
+		return
+	}
+	return
+}
+
+// marshalDependent writes every element of a slice whose length is stored in
+// the sibling field named by the dependsOn tag, the two have to agree
+func marshalDependent(w io.Writer, opts EncodeOptions, field *reflect.StructField, tagz *fixedTags, val reflect.Value, parent reflect.Value, earlier []layoutField) (err error) {
+	var count int
+	if count, err = dependentCount(parent, earlier, field.Name, tagz.DependsOn); err != nil {
+		return
+	}
+	for val.Kind() == reflect.Ptr {
+		val = val.Elem()
+	}
+	if val.Len() != count {
+		err = errors.New(fmt.Sprintf("slice field %s has %d elements but %s is %d", field.Name, val.Len(), tagz.DependsOn, count))
+		return
+	}
+	for j := 0; j < val.Len(); j += 1 {
+		if err = marshalRecursive(w, opts, field, tagz, val.Index(j)); err != nil {
+			err = elementError(err, j, tagz.Len, nil)
+			return
+		}
+	}
+	return
+}
+
+// marshalFiller writes the blank columns of a filler
+func marshalFiller(w io.Writer, opts EncodeOptions, tag *fixedTags, width int) (err error) {
+	b := alignAndPad2Len(tag.Align, "", tag.Pad, width)
+	if cs := charsetOf(opts.Charset, tag); cs != nil {
+		var t *fixedTags
+		if t, err = latin1Tags(tag); err != nil {
+			return
+		}
+		b = alignAndPad2Len(t.Align, "", t.Pad, width)
+		w = &transcoder{w: w, cs: cs}
+	}
+	_, err = w.Write(b)
+	return
+}
+
+// the encode functions below format a single column, they are shared with
+// the Field methods used by generated code
+
+func encodeNil(tag *fixedTags) []byte {
+	return alignAndPad2Len(tag.Align, tag.Unknown, tag.Pad, tag.Len)
+}
+
+func encodeString(s string, tag *fixedTags) (b []byte, err error) {
+	if tag.Width != widthBytes {
+		if err = checkOverflow(s, textWidth(s, tag.Width), tag.Len, tag); err != nil {
+			return
+		}
+		b = padColumns(tag.Align, s, tag.Pad, tag.Len, tag.Width)
+		return
+	}
+	if err = checkOverflow(s, len(s), tag.Len, tag); err != nil {
+		return
+	}
+	b = alignAndPad2Len(tag.Align, s, tag.Pad, tag.Len)
+	return
+}
+
+func encodeInt(i int64, tag *fixedTags) (b []byte, err error) {
+	if b, err = encodeNumber(strconv.FormatInt(i, tag.Base), tag); err != nil {
+		return
+	}
+	// always do upper case for hex and stuff
+	if tag.Base != 10 {
+		b = bytes.ToUpper(b)
+	}
+	return
+}
+
+func encodeUint(i uint64, tag *fixedTags) (b []byte, err error) {
+	if b, err = encodeNumber(strconv.FormatUint(i, tag.Base), tag); err != nil {
+		return
+	}
+	if tag.Base != 10 {
+		b = bytes.ToUpper(b)
+	}
+	return
+}
+
+func encodeFloat(f float64, bitSize int, tag *fixedTags) ([]byte, error) {
+	return encodeNumber(formatFloat(f, bitSize, tag), tag)
+}
+
+func encodeBool(v bool, tag *fixedTags) ([]byte, error) {
+	token := tag.False
+	if v {
+		token = tag.True
+	}
+	return encodeString(token, tag)
+}
+
+func encodeTime(t time.Time, tag *fixedTags) (b []byte, err error) {
+	if tag.Format == "" {
+		err = errors.New("no date format specified")
+		return
+	}
+	return encodeString(t.Format(tag.Format), tag)
+}
+
+func encodeBytes(v []byte, tag *fixedTags) (b []byte, err error) {
+	if err = checkOverflow(string(v), len(v), tag.Len, tag); err != nil {
 		return
 	}
+	b = bytes.Repeat([]byte(tag.Pad), tag.Len)
+	copy(b, v)
 	return
 }
 
@@ -2,9 +2,12 @@ package fixedwidth
 
 import (
 	"testing"
+	"errors"
 	"bytes"
 	"time"
 	"strings"
+	"strconv"
+	"reflect"
 )
 
 func TestMarshalIntegerZeroPad(t *testing.T) {
@@ -170,3 +173,395 @@ func TestMarshalCustom(t *testing.T) {
 		t.Error("Date decoded incorrectly, expected: '" + string(data) + "' got: '" + dest.Date1.Format("01022006") + "'")
 	}
 }
+
+func TestMarshalUnsigned(t *testing.T) {
+	data := []byte("00000000001844674407370955161500FF")
+	src := struct {
+		Number1 uint8  `fixed:"len:10"`
+		Number2 uint64 `fixed:"len:20"`
+		Number3 uint16 `fixed:"len:4,base:16"`
+	}{Number2: 18446744073709551615, Number3: 255}
+	res, err := Marshal(src)
+	if err != nil {
+		t.Error(err)
+	}
+	if bytes.Compare(res, data) != 0 {
+		t.Error("Number decoded incorrectly expected:", string(data), "got:", string(res))
+	}
+}
+
+func TestMarshalFloat(t *testing.T) {
+	data := []byte("0001234.560001234560012.5")
+	src := struct {
+		Explicit float64 `fixed:"len:10,decimals:2"`
+		Implied  float64 `fixed:"len:9,decimals:2,implied:true"`
+		Shortest float32 `fixed:"len:6"`
+	}{Explicit: 1234.56, Implied: 1234.56, Shortest: 12.5}
+	res, err := Marshal(src)
+	if err != nil {
+		t.Error(err)
+	}
+	if bytes.Compare(res, data) != 0 {
+		t.Error("Float decoded incorrectly expected:", string(data), "got:", string(res))
+	}
+}
+
+func TestMarshalSign(t *testing.T) {
+	for _, c := range []struct {
+		number int
+		tag    string
+		data   string
+	}{
+		{-12, "len:5", "-0012"},
+		{12, "len:5", "00012"},
+		{-12, "len:5,pad: ", "  -12"},
+		{-12, "len:5,sign:trailing", "0012-"},
+		{-12, "len:5,sign:trailing,pad: ", "  12-"},
+		{12, "len:5,sign:always", "+0012"},
+		{12, "len:5,sign:always,pad: ", "  +12"},
+		{-12, "len:5,sign:separate,pad: ", "-  12"},
+		{12, "len:5,sign:separate,pad: ", "+  12"},
+	} {
+		res := signAndPad2Len(strconv.Itoa(c.number), mustParseTags(t, c.tag))
+		if string(res) != c.data {
+			t.Errorf("Number %d with %s decoded incorrectly expected: '%s' got: '%s'", c.number, c.tag, c.data, res)
+		}
+	}
+
+	data := []byte("-0012-12.5")
+	src := struct {
+		Number int     `fixed:"len:5,sign:leading"`
+		Float  float64 `fixed:"len:5,decimals:1"`
+	}{Number: -12, Float: -12.5}
+	res, err := Marshal(src)
+	if err != nil {
+		t.Error(err)
+	}
+	if bytes.Compare(res, data) != 0 {
+		t.Error("Number decoded incorrectly expected:", string(data), "got:", string(res))
+	}
+}
+
+func mustParseTags(t *testing.T, tag string) *fixedTags {
+	field := reflect.StructField{Name: "Test", Type: reflect.TypeOf(0), Tag: reflect.StructTag(`fixed:"` + tag + `"`)}
+	tagz, err := parseTags(field, reflect.Int)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tagz
+}
+
+func TestMarshalZoned(t *testing.T) {
+	data := []byte("000012{00001J00012345}")
+	src := struct {
+		Number1 int     `fixed:"len:7,encoding:zoned"`
+		Number2 int64   `fixed:"len:6,encoding:zoned"`
+		Amount  float64 `fixed:"len:9,encoding:zoned,decimals:2"`
+	}{Number1: 120, Number2: -11, Amount: -1234.50}
+	res, err := Marshal(src)
+	if err != nil {
+		t.Error(err)
+	}
+	if bytes.Compare(res, data) != 0 {
+		t.Error("Zoned decoded incorrectly expected:", string(data), "got:", string(res))
+	}
+}
+
+func TestMarshalPacked(t *testing.T) {
+	data := []byte{0x00, 0x12, 0x0C, 0x12, 0x34, 0x5D, 0x00, 0x00, 0x00, 0x0C}
+	src := struct {
+		Number int     `fixed:"len:3,encoding:packed"`
+		Amount float64 `fixed:"len:3,encoding:packed,decimals:2"`
+		Zero   *uint32 `fixed:"len:4,encoding:packed"`
+	}{Number: 120, Amount: -123.45}
+	var zero uint32
+	src.Zero = &zero
+	res, err := Marshal(src)
+	if err != nil {
+		t.Error(err)
+	}
+	if bytes.Compare(res, data) != 0 {
+		t.Errorf("Packed decoded incorrectly expected: % X got: % X", data, res)
+	}
+}
+
+func TestMarshalBool(t *testing.T) {
+	data := []byte("10YN ?")
+	src := struct {
+		Default1 bool  `fixed:"len:1"`
+		Default2 bool  `fixed:"len:1"`
+		Custom1  bool  `fixed:"len:1,true:Y,false:N"`
+		Custom2  *bool `fixed:"len:1,true:Y,false:N"`
+		Blank    *bool `fixed:"len:1"`
+		Unknown  *bool `fixed:"len:1,unknown:?"`
+	}{Default1: true}
+	f := false
+	src.Custom1 = true
+	src.Custom2 = &f
+	res, err := Marshal(src)
+	if err != nil {
+		t.Error(err)
+	}
+	if bytes.Compare(res, data) != 0 {
+		t.Error("Bool decoded incorrectly expected:", string(data), "got:", string(res))
+	}
+}
+
+type occursRec struct {
+	Code   string `fixed:"len:2"`
+	Amount int    `fixed:"len:3"`
+}
+
+func TestMarshalArray(t *testing.T) {
+	data := []byte("001002003A  B  C  AA001BB002  000")
+	src := struct {
+		Numbers [3]int       `fixed:"len:3"`
+		Strings []string     `fixed:"len:3,count:3"`
+		Groups  [2]occursRec `fixed:"len:5"`
+		Padded  []occursRec  `fixed:"len:5,count:1"`
+	}{
+		Numbers: [3]int{1, 2, 3},
+		Strings: []string{"A", "B", "C"},
+		Groups:  [2]occursRec{{"AA", 1}, {"BB", 2}},
+	}
+	res, err := Marshal(src)
+	if err != nil {
+		t.Error(err)
+	}
+	if bytes.Compare(res, data) != 0 {
+		t.Error("Array decoded incorrectly expected:", string(data), "got:", string(res))
+	}
+
+	src.Strings = []string{"A", "B", "C", "D"}
+	if _, err := Marshal(src); err == nil {
+		t.Error("Expected error for slice longer than count")
+	}
+}
+
+func TestMarshalDependsOn(t *testing.T) {
+	data := []byte("02AA001BB002END")
+	src := struct {
+		ItemCount int         `fixed:"len:2"`
+		Items     []occursRec `fixed:"len:5,dependsOn:ItemCount"`
+		Trailer   string      `fixed:"len:3"`
+	}{ItemCount: 2, Items: []occursRec{{"AA", 1}, {"BB", 2}}, Trailer: "END"}
+	res, err := Marshal(src)
+	if err != nil {
+		t.Error(err)
+	}
+	if bytes.Compare(res, data) != 0 {
+		t.Error("DependsOn decoded incorrectly expected:", string(data), "got:", string(res))
+	}
+
+	src.ItemCount = 3
+	if _, err := Marshal(src); err == nil {
+		t.Error("Expected error for counter not matching slice length")
+	}
+}
+
+type nestedAddress struct {
+	Street string `fixed:"len:6"`
+	Zip    int    `fixed:"len:5"`
+}
+
+func TestMarshalNested(t *testing.T) {
+	data := []byte("BobMain  00042Elm   00007Oak   00001    X")
+	src := struct {
+		Name    string        `fixed:"len:3"`
+		Home    nestedAddress `fixed:""`
+		Work    nestedAddress
+		Other   *nestedAddress `fixed:"len:15"`
+		Trailer string         `fixed:"len:1"`
+	}{
+		Name:    "Bob",
+		Home:    nestedAddress{"Main", 42},
+		Work:    nestedAddress{"Elm", 7},
+		Other:   &nestedAddress{"Oak", 1},
+		Trailer: "X",
+	}
+	res, err := Marshal(src)
+	if err != nil {
+		t.Error(err)
+	}
+	if bytes.Compare(res, data) != 0 {
+		t.Error("Nested decoded incorrectly expected:", string(data), "got:", string(res))
+	}
+}
+
+type EmbeddedHeader struct {
+	RecordType string `fixed:"len:1"`
+	Sequence   int    `fixed:"len:3"`
+}
+
+type embeddedTrailer struct {
+	Checksum int `fixed:"len:2"`
+}
+
+type embeddedRec struct {
+	EmbeddedHeader
+	Name string `fixed:"len:4"`
+	embeddedTrailer
+}
+
+func TestMarshalEmbedded(t *testing.T) {
+	data := []byte("D007Bob 42")
+	src := embeddedRec{Name: "Bob"}
+	src.RecordType = "D"
+	src.Sequence = 7
+	src.Checksum = 42
+	res, err := Marshal(src)
+	if err != nil {
+		t.Error(err)
+	}
+	if bytes.Compare(res, data) != 0 {
+		t.Error("Embedded decoded incorrectly expected:", string(data), "got:", string(res))
+	}
+
+	ptr := struct {
+		*EmbeddedHeader
+		Name string `fixed:"len:4"`
+	}{Name: "Bob"}
+	res, err = Marshal(ptr)
+	if err != nil {
+		t.Error(err)
+	}
+	if string(res) != " 000Bob " {
+		t.Error("Embedded decoded incorrectly expected: ' 000Bob ' got:", "'"+string(res)+"'")
+	}
+
+	nested := struct {
+		*EmbeddedBase
+		Name string `fixed:"len:3"`
+	}{Name: "abc"}
+	res, err = Marshal(nested)
+	if err != nil {
+		t.Error(err)
+	}
+	if string(res) != "00           abc" {
+		t.Error("Embedded decoded incorrectly expected: '00           abc' got:", "'"+string(res)+"'")
+	}
+}
+
+// EmbeddedBase has an untagged nested struct
+type EmbeddedBase struct {
+	ID   int `fixed:"len:2"`
+	Addr nestedAddress
+}
+
+func TestMarshalPosition(t *testing.T) {
+	data := []byte("H  0042ZZ Bob  XY")
+	src := struct {
+		Name   string `fixed:"pos:11-15"`
+		Type   string `fixed:"pos:1-1"`
+		Number int    `fixed:"start:4,len:4"`
+		Code   string `fixed:"len:2"`
+		Extra  string `fixed:"start:16,end:17"`
+	}{Name: "Bob", Type: "H", Number: 42, Code: "ZZ", Extra: "XY"}
+	res, err := Marshal(src)
+	if err != nil {
+		t.Error(err)
+	}
+	if bytes.Compare(res, data) != 0 {
+		t.Error("Position decoded incorrectly expected:", string(data), "got:", string(res))
+	}
+}
+
+func TestMarshalFiller(t *testing.T) {
+	data := []byte("AB   CD**0001")
+	src := struct {
+		First  string   `fixed:"len:2"`
+		_      struct{} `fixed:"-,len:3"`
+		Second string   `fixed:"len:2"`
+		_      int      `fixed:"-,len:2,pad:*"`
+		Number int      `fixed:"len:4"`
+	}{First: "AB", Second: "CD", Number: 1}
+	res, err := Marshal(src)
+	if err != nil {
+		t.Error(err)
+	}
+	if bytes.Compare(res, data) != 0 {
+		t.Error("Filler decoded incorrectly expected:", string(data), "got:", string(res))
+	}
+}
+
+func TestMarshalPositionOverlap(t *testing.T) {
+	src := struct {
+		A string `fixed:"pos:1-5"`
+		B string `fixed:"pos:3-6"`
+	}{"AAAAA", "BBBB"}
+	if _, err := Marshal(src); err == nil {
+		t.Error("Expected error for overlapping positions")
+	}
+	var dest struct {
+		A string `fixed:"len:2"`
+		B string `fixed:"len:2"`
+		C string `fixed:"pos:2-3"`
+	}
+	if err := Unmarshal([]byte("AABB"), &dest); err == nil {
+		t.Error("Expected error for a position overlapping earlier fields")
+	}
+}
+
+func TestMarshalOverflow(t *testing.T) {
+	cases := []struct {
+		src  interface{}
+		data string
+		err  bool
+	}{
+		{struct {
+			N int `fixed:"len:4"`
+		}{12345}, "", true},
+		{struct {
+			N int `fixed:"len:4,sign:always"`
+		}{1234}, "", true},
+		{struct {
+			N float64 `fixed:"len:6,decimals:2"`
+		}{1234.5}, "", true},
+		{struct {
+			N int `fixed:"len:2,encoding:packed"`
+		}{1234}, "", true},
+		{struct {
+			N int `fixed:"len:4,overflow:truncate"`
+		}{12345}, "2345", false},
+		{struct {
+			S string `fixed:"len:4"`
+		}{"Hello"}, "Hell", false},
+		{struct {
+			S string `fixed:"len:4,overflow:error"`
+		}{"Hello"}, "", true},
+		{struct {
+			D time.Time `fixed:"len:6,format:01022006"`
+		}{time.Date(1990, 11, 16, 0, 0, 0, 0, time.UTC)}, "", true},
+		{struct {
+			D time.Time `fixed:"len:8,format:0102"`
+		}{time.Date(1990, 11, 16, 0, 0, 0, 0, time.UTC)}, "1116    ", false},
+	}
+	for _, c := range cases {
+		res, err := Marshal(c.src)
+		var oe *OverflowError
+		if c.err && !errors.As(err, &oe) {
+			t.Errorf("Expected an *OverflowError for %+v got: %v", c.src, err)
+		}
+		if !c.err && (err != nil || string(res) != c.data) {
+			t.Errorf("Overflow encoded incorrectly expected: '%s' got: '%s' %v", c.data, res, err)
+		}
+	}
+}
+
+func TestMarshalNilInterface(t *testing.T) {
+	if _, err := Marshal(nil); err == nil {
+		t.Error("Expected error marshaling nil")
+	}
+	src := struct {
+		A string      `fixed:"len:2"`
+		V interface{} `fixed:"len:3"`
+		B string      `fixed:"len:1"`
+	}{A: "ab", B: "c"}
+	res, err := Marshal(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res) != "ab   c" {
+		t.Error("Nil interface encoded incorrectly expected: 'ab   c' got:", "'"+string(res)+"'")
+	}
+}
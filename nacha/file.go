@@ -0,0 +1,266 @@
+package nacha
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	fixedwidth "github.com/pborges/fixed"
+)
+
+// hashModulus cuts entry hashes to their 10 digits
+const hashModulus = 10000000000
+
+// Entry is an entry detail record with its addenda
+type Entry struct {
+	Detail  EntryDetail
+	Addenda []Addenda
+}
+
+// Batch is a batch header, its entries and the batch control
+type Batch struct {
+	Header  BatchHeader
+	Entries []Entry
+	Control BatchControl
+}
+
+// File is a whole ACH file
+type File struct {
+	Header  FileHeader
+	Batches []Batch
+	Control FileControl
+}
+
+// Compute fills in the record types, the constant fields of the file header
+// and the control records from the entries. Addenda indicators and sequence
+// numbers of the entries are set too, trace numbers are left as they are
+func (f *File) Compute() (err error) {
+	f.Header.RecordType = TypeFileHeader
+	f.Header.PriorityCode = 1
+	f.Header.RecordSize = RecordLen
+	f.Header.BlockingFactor = BlockingFactor
+	f.Header.FormatCode = "1"
+
+	c := FileControl{RecordType: TypeFileControl, BatchCount: len(f.Batches)}
+	records := 2
+	for i := range f.Batches {
+		b := &f.Batches[i]
+		if err = b.Compute(); err != nil {
+			err = errors.New(fmt.Sprintf("batch %d: %s", i+1, err))
+			return
+		}
+		c.EntryAddendaCount += b.Control.EntryAddendaCount
+		c.EntryHash = (c.EntryHash + b.Control.EntryHash) % hashModulus
+		c.TotalDebit += b.Control.TotalDebit
+		c.TotalCredit += b.Control.TotalCredit
+		records += 2 + b.Control.EntryAddendaCount
+	}
+	c.BlockCount = (records + BlockingFactor - 1) / BlockingFactor
+	f.Control = c
+	return
+}
+
+// Compute fills in the batch control from the header and the entries
+func (b *Batch) Compute() (err error) {
+	b.Header.RecordType = TypeBatchHeader
+	c := BatchControl{
+		RecordType:                TypeBatchControl,
+		ServiceClassCode:          b.Header.ServiceClassCode,
+		CompanyIdentification:     b.Header.CompanyIdentification,
+		OriginatingDFI:            b.Header.OriginatingDFI,
+		BatchNumber:               b.Header.BatchNumber,
+		MessageAuthenticationCode: b.Control.MessageAuthenticationCode,
+	}
+	for i := range b.Entries {
+		e := &b.Entries[i]
+		e.Detail.RecordType = TypeEntryDetail
+		e.Detail.AddendaRecordIndicator = 0
+		if len(e.Addenda) > 0 {
+			e.Detail.AddendaRecordIndicator = 1
+		}
+		var seq int
+		if seq, err = traceSequence(e.Detail.TraceNumber); err != nil {
+			return
+		}
+		for j := range e.Addenda {
+			a := &e.Addenda[j]
+			a.RecordType = TypeAddenda
+			a.SequenceNumber = j + 1
+			a.EntryDetailSequenceNumber = seq
+		}
+		var dfi int64
+		if dfi, err = strconv.ParseInt(e.Detail.ReceivingDFI, 10, 64); err != nil {
+			err = errors.New(fmt.Sprintf("entry %d: invalid receiving DFI %s", i+1, e.Detail.ReceivingDFI))
+			return
+		}
+		c.EntryHash = (c.EntryHash + dfi) % hashModulus
+		c.EntryAddendaCount += 1 + len(e.Addenda)
+		if IsDebit(e.Detail.TransactionCode) {
+			c.TotalDebit += e.Detail.Amount
+		} else {
+			c.TotalCredit += e.Detail.Amount
+		}
+	}
+	b.Control = c
+	return
+}
+
+// traceSequence is the entry detail sequence number of a trace number, its
+// last 7 digits. A blank trace number is 0
+func traceSequence(trace string) (seq int, err error) {
+	trace = strings.TrimSpace(trace)
+	if trace == "" {
+		return
+	}
+	if len(trace) > 7 {
+		trace = trace[len(trace)-7:]
+	}
+	if seq, err = strconv.Atoi(trace); err != nil {
+		err = errors.New(fmt.Sprintf("invalid trace number %s", trace))
+	}
+	return
+}
+
+// Verify compares the control records with the totals computed from the
+// entries
+func (f *File) Verify() error {
+	// Compute rewrites the entries and addenda in place, work on copies
+	computed := File{Header: f.Header, Batches: make([]Batch, len(f.Batches))}
+	for i, b := range f.Batches {
+		entries := make([]Entry, len(b.Entries))
+		for j, e := range b.Entries {
+			entries[j] = Entry{Detail: e.Detail, Addenda: append([]Addenda(nil), e.Addenda...)}
+		}
+		computed.Batches[i] = Batch{Header: b.Header, Entries: entries}
+		computed.Batches[i].Control.MessageAuthenticationCode = b.Control.MessageAuthenticationCode
+	}
+	if err := computed.Compute(); err != nil {
+		return err
+	}
+	for i, b := range f.Batches {
+		if b.Control != computed.Batches[i].Control {
+			return errors.New(fmt.Sprintf("batch %d: control %+v does not match the entries, expected %+v", i+1, b.Control, computed.Batches[i].Control))
+		}
+	}
+	if f.Control != computed.Control {
+		return errors.New(fmt.Sprintf("file control %+v does not match the batches, expected %+v", f.Control, computed.Control))
+	}
+	return nil
+}
+
+// Encode writes the records of the file to w, one per line, followed by lines
+// of 9s up to a multiple of 10 records. Call Compute first
+func (f *File) Encode(w io.Writer) (err error) {
+	bw := bufio.NewWriter(w)
+	enc := fixedwidth.NewEncoder(bw)
+	records := 0
+	write := func(v interface{}) error {
+		records += 1
+		return enc.Encode(v)
+	}
+	if err = write(f.Header); err != nil {
+		return
+	}
+	for _, b := range f.Batches {
+		if err = write(b.Header); err != nil {
+			return
+		}
+		for _, e := range b.Entries {
+			if err = write(e.Detail); err != nil {
+				return
+			}
+			for _, a := range e.Addenda {
+				if err = write(a); err != nil {
+					return
+				}
+			}
+		}
+		if err = write(b.Control); err != nil {
+			return
+		}
+	}
+	if err = write(f.Control); err != nil {
+		return
+	}
+	filler := strings.Repeat("9", RecordLen) + "\n"
+	for ; records%BlockingFactor != 0; records += 1 {
+		if _, err = bw.WriteString(filler); err != nil {
+			return
+		}
+	}
+	return bw.Flush()
+}
+
+// Decode reads an ACH file from r, the block filler lines are skipped. The
+// controls are read as they are, use Verify to check them
+func Decode(r io.Reader) (f *File, err error) {
+	f = new(File)
+	s := bufio.NewScanner(r)
+	line := 0
+	var batch *Batch
+	var entry *Entry
+	header, control := false, false
+	for s.Scan() {
+		line += 1
+		data := bytes.TrimSuffix(s.Bytes(), []byte("\r"))
+		if len(data) == 0 {
+			continue
+		}
+		if control {
+			if strings.Trim(string(data), "9") != "" {
+				err = errors.New(fmt.Sprintf("line %d: record after the file control", line))
+				return
+			}
+			continue
+		}
+		if len(data) != RecordLen {
+			err = errors.New(fmt.Sprintf("line %d: record is %d characters, expected %d", line, len(data), RecordLen))
+			return
+		}
+		code := string(data[:1])
+		switch {
+		case code == TypeFileHeader && !header:
+			header = true
+			err = fixedwidth.Unmarshal(data, &f.Header)
+		case !header:
+			err = errors.New("file header missing")
+		case code == TypeBatchHeader && batch == nil:
+			f.Batches = append(f.Batches, Batch{})
+			batch = &f.Batches[len(f.Batches)-1]
+			entry = nil
+			err = fixedwidth.Unmarshal(data, &batch.Header)
+		case code == TypeEntryDetail && batch != nil:
+			batch.Entries = append(batch.Entries, Entry{})
+			entry = &batch.Entries[len(batch.Entries)-1]
+			err = fixedwidth.Unmarshal(data, &entry.Detail)
+		case code == TypeAddenda && entry != nil:
+			var a Addenda
+			if err = fixedwidth.Unmarshal(data, &a); err == nil {
+				entry.Addenda = append(entry.Addenda, a)
+			}
+		case code == TypeBatchControl && batch != nil:
+			err = fixedwidth.Unmarshal(data, &batch.Control)
+			batch, entry = nil, nil
+		case code == TypeFileControl && batch == nil:
+			control = true
+			err = fixedwidth.Unmarshal(data, &f.Control)
+		default:
+			err = errors.New(fmt.Sprintf("unexpected record type %s", code))
+		}
+		if err != nil {
+			err = errors.New(fmt.Sprintf("line %d: %s", line, err))
+			return
+		}
+	}
+	if err = s.Err(); err != nil {
+		return
+	}
+	if !control {
+		err = errors.New("file control missing")
+	}
+	return
+}
@@ -0,0 +1,111 @@
+package nacha
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testFile() *File {
+	return &File{
+		Header: FileHeader{
+			ImmediateDestination:     "076401251",
+			ImmediateOrigin:          "123456789",
+			CreationDate:             time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC),
+			CreationTime:             time.Date(0, 1, 1, 9, 30, 0, 0, time.UTC),
+			FileIDModifier:           "A",
+			ImmediateDestinationName: "FIRST BANK",
+			ImmediateOriginName:      "ACME CORP",
+		},
+		Batches: []Batch{{
+			Header: BatchHeader{
+				ServiceClassCode:        ServiceClassMixed,
+				CompanyName:             "ACME CORP",
+				CompanyIdentification:   "1123456789",
+				StandardEntryClassCode:  "PPD",
+				CompanyEntryDescription: "PAYROLL",
+				EffectiveEntryDate:      time.Date(2019, 3, 4, 0, 0, 0, 0, time.UTC),
+				OriginatorStatusCode:    "1",
+				OriginatingDFI:          "07640125",
+				BatchNumber:             1,
+			},
+			Entries: []Entry{
+				{Detail: EntryDetail{TransactionCode: 22, ReceivingDFI: "23138010", CheckDigit: 4, AccountNumber: "12345678",
+					Amount: 150000, IndividualName: "JANE DOE", TraceNumber: "076401250000001"}},
+				{Detail: EntryDetail{TransactionCode: 27, ReceivingDFI: "99999999", CheckDigit: 7, AccountNumber: "87654321",
+					Amount: 2599, IndividualName: "JOHN DOE", TraceNumber: "076401250000002"},
+					Addenda: []Addenda{{AddendaTypeCode: "05", PaymentRelatedInformation: "INVOICE 42"}}},
+			},
+		}},
+	}
+}
+
+func TestEncode(t *testing.T) {
+	f := testFile()
+	if err := f.Compute(); err != nil {
+		t.Fatal(err)
+	}
+	c := f.Batches[0].Control
+	if c.EntryAddendaCount != 3 || c.EntryHash != 123138009 || c.TotalCredit != 150000 || c.TotalDebit != 2599 {
+		t.Error("Batch control computed incorrectly got:", c)
+	}
+	if f.Control.BatchCount != 1 || f.Control.BlockCount != 1 || f.Control.EntryHash != 123138009 {
+		t.Error("File control computed incorrectly got:", f.Control)
+	}
+
+	buf := bytes.Buffer{}
+	if err := f.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 10 {
+		t.Fatal("Encode incorrectly expected 10 lines got:", len(lines))
+	}
+	for i, l := range lines {
+		if len(l) != RecordLen {
+			t.Errorf("Encode incorrectly expected line %d to be %d long got: %d %q", i+1, RecordLen, len(l), l)
+		}
+	}
+	expected := []string{
+		"101 076401251 1234567891903010930A094101FIRST BANK             ACME CORP                      ",
+		"5200ACME CORP                           1123456789PPDPAYROLL         190304   1076401250000001",
+		"62223138010412345678         0000150000               JANE DOE                0076401250000001",
+		"62799999999787654321         0000002599               JOHN DOE                1076401250000002",
+		"705INVOICE 42                                                                      00010000002",
+		"820000000301231380090000000025990000001500001123456789                         076401250000001",
+		"9000001000001000000030123138009000000002599000000150000                                       ",
+		strings.Repeat("9", RecordLen),
+	}
+	for i, e := range expected {
+		if lines[i] != e {
+			t.Errorf("Encode line %d incorrectly expected:\n%q got:\n%q", i+1, e, lines[i])
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	src := testFile()
+	src.Compute()
+	buf := bytes.Buffer{}
+	if err := src.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	f, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Batches) != 1 || len(f.Batches[0].Entries) != 2 || len(f.Batches[0].Entries[1].Addenda) != 1 {
+		t.Fatal("Decode incorrectly expected 1 batch with 2 entries got:", f.Batches)
+	}
+	if f.Batches[0].Entries[1].Detail != src.Batches[0].Entries[1].Detail || f.Control != src.Control {
+		t.Error("Decode incorrectly expected:", src.Batches[0].Entries[1].Detail, src.Control, "got:", f.Batches[0].Entries[1].Detail, f.Control)
+	}
+	if err := f.Verify(); err != nil {
+		t.Error(err)
+	}
+	f.Batches[0].Entries[0].Detail.Amount += 1
+	if err := f.Verify(); err == nil {
+		t.Error("Expected error verifying a changed amount")
+	}
+}
@@ -0,0 +1,138 @@
+// Package nacha reads and writes NACHA ACH files. Every record is 94
+// characters, laid out with the fixed tags of github.com/pborges/fixed at
+// the positions of the NACHA operating rules.
+//
+// A File holds batches of entries, File.Compute fills in the control records
+// and counts, File.Encode writes the records blocked to a multiple of 10 lines
+// with lines of 9s.
+package nacha
+
+import (
+	"time"
+)
+
+// RecordLen is the length of every record of an ACH file
+const RecordLen = 94
+
+// BlockingFactor is the number of records per block
+const BlockingFactor = 10
+
+// record type codes, the first column of every record
+const (
+	TypeFileHeader   = "1"
+	TypeBatchHeader  = "5"
+	TypeEntryDetail  = "6"
+	TypeAddenda      = "7"
+	TypeBatchControl = "8"
+	TypeFileControl  = "9"
+)
+
+// service class codes of batch headers and controls
+const (
+	ServiceClassMixed   = 200
+	ServiceClassCredits = 220
+	ServiceClassDebits  = 225
+)
+
+// FileHeader is the first record of a file, type 1
+type FileHeader struct {
+	RecordType string `fixed:"pos:1-1"`
+	// always 01
+	PriorityCode int `fixed:"pos:2-3"`
+	// routing number of the receiving point, with a leading space
+	ImmediateDestination string    `fixed:"pos:4-13,align:right"`
+	ImmediateOrigin      string    `fixed:"pos:14-23,align:right"`
+	CreationDate         time.Time `fixed:"pos:24-29,format:060102"`
+	CreationTime         time.Time `fixed:"pos:30-33,format:1504"`
+	// A to Z and 0 to 9 to tell files created on the same day apart
+	FileIDModifier string `fixed:"pos:34-34"`
+	// always 094
+	RecordSize int `fixed:"pos:35-37"`
+	// always 10
+	BlockingFactor int `fixed:"pos:38-39"`
+	// always 1
+	FormatCode               string `fixed:"pos:40-40"`
+	ImmediateDestinationName string `fixed:"pos:41-63"`
+	ImmediateOriginName      string `fixed:"pos:64-86"`
+	ReferenceCode            string `fixed:"pos:87-94"`
+}
+
+// BatchHeader starts a batch of entries, type 5
+type BatchHeader struct {
+	RecordType               string    `fixed:"pos:1-1"`
+	ServiceClassCode         int       `fixed:"pos:2-4"`
+	CompanyName              string    `fixed:"pos:5-20"`
+	CompanyDiscretionaryData string    `fixed:"pos:21-40"`
+	CompanyIdentification    string    `fixed:"pos:41-50"`
+	StandardEntryClassCode   string    `fixed:"pos:51-53"`
+	CompanyEntryDescription  string    `fixed:"pos:54-63"`
+	CompanyDescriptiveDate   string    `fixed:"pos:64-69"`
+	EffectiveEntryDate       time.Time `fixed:"pos:70-75,format:060102"`
+	// julian day, filled in by the ACH operator
+	SettlementDate       string `fixed:"pos:76-78"`
+	OriginatorStatusCode string `fixed:"pos:79-79"`
+	OriginatingDFI       string `fixed:"pos:80-87"`
+	BatchNumber          int    `fixed:"pos:88-94"`
+}
+
+// EntryDetail is a single payment, type 6
+type EntryDetail struct {
+	RecordType      string `fixed:"pos:1-1"`
+	TransactionCode int    `fixed:"pos:2-3"`
+	// first 8 digits of the routing number of the receiving bank
+	ReceivingDFI  string `fixed:"pos:4-11"`
+	CheckDigit    int    `fixed:"pos:12-12"`
+	AccountNumber string `fixed:"pos:13-29"`
+	// in cents
+	Amount                   int64  `fixed:"pos:30-39"`
+	IndividualIdentification string `fixed:"pos:40-54"`
+	IndividualName           string `fixed:"pos:55-76"`
+	DiscretionaryData        string `fixed:"pos:77-78"`
+	AddendaRecordIndicator   int    `fixed:"pos:79-79"`
+	TraceNumber              string `fixed:"pos:80-94"`
+}
+
+// Addenda carries payment related information of an entry, type 7
+type Addenda struct {
+	RecordType                string `fixed:"pos:1-1"`
+	AddendaTypeCode           string `fixed:"pos:2-3"`
+	PaymentRelatedInformation string `fixed:"pos:4-83"`
+	SequenceNumber            int    `fixed:"pos:84-87"`
+	// last 7 digits of the trace number of the entry
+	EntryDetailSequenceNumber int `fixed:"pos:88-94"`
+}
+
+// BatchControl ends a batch, type 8
+type BatchControl struct {
+	RecordType        string `fixed:"pos:1-1"`
+	ServiceClassCode  int    `fixed:"pos:2-4"`
+	EntryAddendaCount int    `fixed:"pos:5-10"`
+	// sum of the receiving DFIs of the entries, cut to 10 digits
+	EntryHash                 int64  `fixed:"pos:11-20,overflow:truncate"`
+	TotalDebit                int64  `fixed:"pos:21-32"`
+	TotalCredit               int64  `fixed:"pos:33-44"`
+	CompanyIdentification     string `fixed:"pos:45-54"`
+	MessageAuthenticationCode string `fixed:"pos:55-73"`
+	_                         string `fixed:"-,pos:74-79"`
+	OriginatingDFI            string `fixed:"pos:80-87"`
+	BatchNumber               int    `fixed:"pos:88-94"`
+}
+
+// FileControl is the last record of a file before the block filler, type 9
+type FileControl struct {
+	RecordType        string `fixed:"pos:1-1"`
+	BatchCount        int    `fixed:"pos:2-7"`
+	BlockCount        int    `fixed:"pos:8-13"`
+	EntryAddendaCount int    `fixed:"pos:14-21"`
+	// sum of the entry hashes of the batches, cut to 10 digits
+	EntryHash   int64  `fixed:"pos:22-31,overflow:truncate"`
+	TotalDebit  int64  `fixed:"pos:32-43"`
+	TotalCredit int64  `fixed:"pos:44-55"`
+	_           string `fixed:"-,pos:56-94"`
+}
+
+// IsDebit reports whether a transaction code debits the receiver, codes
+// ending in 5 to 9. Codes ending in 0 to 4 are credits
+func IsDebit(transactionCode int) bool {
+	return transactionCode%10 >= 5
+}
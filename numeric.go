@@ -0,0 +1,153 @@
+package fixedwidth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// overpunched last digits of a zoned decimal, indexed by digit
+const zonedPositive = "{ABCDEFGHI"
+const zonedNegative = "}JKLMNOPQR"
+
+// encodeNumber writes a formatted number such as "-123" or "12.50" in the
+// encoding requested by the field tags
+func encodeNumber(s string, tag *fixedTags) (b []byte, err error) {
+	digits := strings.TrimPrefix(s, "-")
+	switch tag.Encoding {
+	case encodingZoned:
+		if err = checkOverflow(s, len(digits), tag.Len, tag); err != nil {
+			return
+		}
+		return zonedEncode(s, tag.Len)
+	case encodingPacked:
+		if err = checkOverflow(s, len(digits), tag.Len*2-1, tag); err != nil {
+			return
+		}
+		return packedEncode(s, tag.Len)
+	}
+	width := len(s)
+	if digits == s && (tag.Sign == signAlways || tag.Sign == signSeparate) {
+		width += 1
+	}
+	if err = checkOverflow(s, width, tag.Len, tag); err != nil {
+		return
+	}
+	return signAndPad2Len(s, tag), nil
+}
+
+// decodeNumber is the inverse of encodeNumber, it returns the sign and the
+// digits of the number found in data, both are empty for a blank field
+func decodeNumber(data []byte, tag *fixedTags) (sign string, digits string, err error) {
+	switch tag.Encoding {
+	case encodingZoned:
+		return zonedDecode(string(data))
+	case encodingPacked:
+		return packedDecode(data)
+	}
+	sign, digits = splitSign(string(data), tag.Pad)
+	return
+}
+
+// zonedEncode zero pads the digits of s to l and overpunches the sign onto
+// the last digit, -120 becomes "00012}" and 120 "00012{"
+func zonedEncode(s string, l int) (b []byte, err error) {
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	if l <= 0 {
+		return
+	}
+	b = leftPad2Len(s, "0", l)
+	last := b[l-1]
+	if last < '0' || last > '9' {
+		err = errors.New(fmt.Sprintf("cannot zone encode %s", s))
+		return
+	}
+	if neg {
+		b[l-1] = zonedNegative[last-'0']
+	} else {
+		b[l-1] = zonedPositive[last-'0']
+	}
+	return
+}
+
+// zonedDecode reads the overpunched sign from the last digit of s, plain
+// unsigned digits are accepted as well
+func zonedDecode(s string) (sign string, digits string, err error) {
+	s = strings.Trim(s, " ")
+	if s == "" {
+		return
+	}
+	last := s[len(s)-1]
+	if i := strings.IndexByte(zonedPositive, last); i >= 0 {
+		digits = s[:len(s)-1] + string(rune('0'+i))
+	} else if i := strings.IndexByte(zonedNegative, last); i >= 0 {
+		sign = "-"
+		digits = s[:len(s)-1] + string(rune('0'+i))
+	} else if last >= '0' && last <= '9' {
+		digits = s
+	} else {
+		err = errors.New(fmt.Sprintf("invalid zoned decimal %s", s))
+	}
+	return
+}
+
+// packedEncode writes s as a COMP-3 packed decimal of l bytes, two digits per
+// byte with the sign in the last nibble, -120 in 3 bytes is 0x00 0x12 0x0D
+func packedEncode(s string, l int) (b []byte, err error) {
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	if l <= 0 {
+		return
+	}
+	digits := leftPad2Len(s, "0", l*2-1)
+	b = make([]byte, l)
+	for i, d := range digits {
+		if d < '0' || d > '9' {
+			err = errors.New(fmt.Sprintf("cannot pack %s", s))
+			return
+		}
+		if i%2 == 0 {
+			b[i/2] = (d - '0') << 4
+		} else {
+			b[i/2] |= d - '0'
+		}
+	}
+	if neg {
+		b[l-1] |= 0x0D
+	} else {
+		b[l-1] |= 0x0C
+	}
+	return
+}
+
+// packedDecode unpacks a COMP-3 packed decimal, a field of spaces or of NUL
+// bytes, COBOL LOW-VALUES, is blank
+func packedDecode(b []byte) (sign string, digits string, err error) {
+	if len(strings.Trim(string(b), " ")) == 0 || len(strings.Trim(string(b), "\x00")) == 0 {
+		return
+	}
+	buf := make([]byte, 0, len(b)*2-1)
+	for i, c := range b {
+		hi, lo := c>>4, c&0x0F
+		if hi > 9 || (i < len(b)-1 && lo > 9) {
+			err = errors.New(fmt.Sprintf("invalid packed decimal % X", b))
+			return
+		}
+		buf = append(buf, '0'+hi)
+		if i < len(b)-1 {
+			buf = append(buf, '0'+lo)
+			continue
+		}
+		switch lo {
+		case 0x0B, 0x0D:
+			sign = "-"
+		case 0x0A, 0x0C, 0x0E, 0x0F:
+		default:
+			err = errors.New(fmt.Sprintf("invalid packed decimal sign % X", b))
+			return
+		}
+	}
+	digits = string(buf)
+	return
+}
@@ -0,0 +1,80 @@
+package fixedwidth
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// RegisterRecordType makes the struct type of v the type of the records
+// DecodeRecord reads whose discriminator is code, see SetDiscriminator. v may
+// be a struct or a pointer to one. Registering a code twice for different
+// types panics
+func (d *Decoder) RegisterRecordType(code string, v interface{}) {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("fixedwidth: record type %T for %q is not a struct", v, code))
+	}
+	if d.recordTypes == nil {
+		d.recordTypes = make(map[string]reflect.Type)
+	}
+	if prev, ok := d.recordTypes[code]; ok && prev != t {
+		panic(fmt.Sprintf("fixedwidth: record type %q registered for %s and %s", code, prev, t))
+	}
+	d.recordTypes[code] = t
+}
+
+// SetDiscriminator sets the 1 based inclusive column range, like a pos tag,
+// holding the record type code DecodeRecord looks up
+func (d *Decoder) SetDiscriminator(start int, end int) {
+	d.discStart, d.discEnd = start, end
+}
+
+// DecodeRecord reads the next record into a new value of the type registered
+// for its discriminator and returns a pointer to it, a *HeaderRec for a code
+// registered with HeaderRec{}. At the end of the input it returns io.EOF
+func (d *Decoder) DecodeRecord() (v interface{}, err error) {
+	if d.discStart < 1 || d.discEnd < d.discStart {
+		err = errors.New("no discriminator set")
+		return
+	}
+	var data []byte
+	if d.terminator == TerminatorNone {
+		// the length of the record depends on its type, peek at the code
+		if data, err = d.r.Peek(d.discEnd); err != nil && len(data) == 0 {
+			return
+		}
+	} else if data, err = d.readLine(); err != nil {
+		return
+	}
+	d.record++
+	if len(data) < d.discEnd {
+		err = errors.New(fmt.Sprintf("record %d %q too short for the discriminator at %d-%d", d.record, data, d.discStart, d.discEnd))
+		return
+	}
+	code := string(data[d.discStart-1 : d.discEnd])
+	if d.opts.Charset != nil {
+		code = d.opts.Charset.Decode(data[d.discStart-1 : d.discEnd])
+	}
+	t, ok := d.recordTypes[code]
+	if !ok {
+		err = errors.New(fmt.Sprintf("unknown record type %q in record %d", code, d.record))
+		return
+	}
+	rec := reflect.New(t)
+	if d.terminator == TerminatorNone {
+		if data, err = d.readFixed(rec.Type()); err != nil {
+			return
+		}
+	}
+	if err = UnmarshalWithOptions(data, rec.Interface(), d.opts); err != nil {
+		err = d.recordError(err)
+		return
+	}
+	v = rec.Interface()
+	err = d.total(v)
+	return
+}
@@ -0,0 +1,90 @@
+package fixedwidth
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+type recHeader struct {
+	Type string `fixed:"len:1"`
+	Name string `fixed:"len:6"`
+}
+
+type recDetail struct {
+	Type   string `fixed:"len:1"`
+	Amount int    `fixed:"len:4"`
+}
+
+// newRecDecoder returns a Decoder of recHeader and recDetail records
+func newRecDecoder(r io.Reader) *Decoder {
+	dec := NewDecoder(r)
+	dec.RegisterRecordType("H", recHeader{})
+	dec.RegisterRecordType("D", &recDetail{})
+	dec.SetDiscriminator(1, 1)
+	return dec
+}
+
+func TestDecodeRecord(t *testing.T) {
+	for _, term := range []Terminator{TerminatorLF, TerminatorNone} {
+		src := "HBatch1" + string(term) + "D0012" + string(term) + "D0034" + string(term)
+		dec := newRecDecoder(strings.NewReader(src))
+		dec.SetTerminator(term)
+		total := 0
+		var name string
+		for {
+			rec, err := dec.DecodeRecord()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch r := rec.(type) {
+			case *recHeader:
+				name = r.Name
+			case *recDetail:
+				total += r.Amount
+			default:
+				t.Fatalf("DecodeRecord returned unexpected %T", rec)
+			}
+		}
+		if name != "Batch1" || total != 46 {
+			t.Errorf("DecodeRecord incorrectly expected: Batch1 46 got: %s %d", name, total)
+		}
+	}
+
+	dec := newRecDecoder(strings.NewReader("X0001\n"))
+	if _, err := dec.DecodeRecord(); err == nil {
+		t.Error("Expected error for an unknown record type")
+	}
+}
+
+func TestRegisterRecordTypeTwice(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected panic registering a code for a second type")
+		}
+	}()
+	newRecDecoder(strings.NewReader("")).RegisterRecordType("H", recDetail{})
+}
+
+func TestRegisterRecordTypePerDecoder(t *testing.T) {
+	type other struct {
+		Type string `fixed:"len:1"`
+		Note string `fixed:"len:4"`
+	}
+	dec := NewDecoder(strings.NewReader("Hnote\n"))
+	dec.RegisterRecordType("H", other{})
+	dec.SetDiscriminator(1, 1)
+	rec, err := dec.DecodeRecord()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, ok := rec.(*other); !ok || r.Note != "note" {
+		t.Errorf("DecodeRecord incorrectly expected: &{H note} got: %v", rec)
+	}
+	if _, err := NewDecoder(strings.NewReader("Hnote\n")).DecodeRecord(); err == nil {
+		t.Error("Expected error decoding a record without registered types")
+	}
+}
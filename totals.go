@@ -0,0 +1,262 @@
+package fixedwidth
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Totals accumulates the control totals of the records of a file, their
+// number and the sums of their numeric fields by field name. A trailer
+// field tagged total:Amount holds the sum of the Amount fields of the records
+// added before it, one tagged total:records their number. Sums are cut to
+// the width of trailer fields tagged overflow:truncate, like the hash totals
+// of bank files.
+//
+// Records encoded or decoded by an Encoder or Decoder with totals set are
+// added automatically, and the total fields of their trailers filled in or
+// verified. Headers are added too unless the records are limited to their
+// details with SetRecordTypes
+type Totals struct {
+	count  int
+	ints   map[string]int64
+	floats map[string]float64
+	// the struct types of the records to add, nil for all
+	types map[reflect.Type]bool
+}
+
+// TotalsError is returned by Totals.Verify when the total fields of a
+// trailer do not match the records
+type TotalsError struct {
+	Struct     string
+	Mismatches []TotalMismatch
+}
+
+// TotalMismatch is a single total field that does not match
+type TotalMismatch struct {
+	Field string
+	// the value of the total tag
+	Total string
+	Want  string
+	Got   string
+}
+
+func (e *TotalsError) Error() string {
+	m := make([]string, len(e.Mismatches))
+	for i, x := range e.Mismatches {
+		m[i] = fmt.Sprintf("%s (total of %s) is %s, expected %s", x.Field, x.Total, x.Got, x.Want)
+	}
+	return fmt.Sprintf("fixedwidth: control totals of %s do not match, %s", e.Struct, strings.Join(m, ", "))
+}
+
+// Reset clears the totals, at the start of a new batch for example. The
+// record types are kept
+func (t *Totals) Reset() {
+	*t = Totals{types: t.types}
+}
+
+// SetRecordTypes limits the records Add adds to those of the struct types of
+// v, structs or pointers to them. Records of other types are ignored, the
+// headers of a file for example
+func (t *Totals) SetRecordTypes(v ...interface{}) {
+	t.types = make(map[reflect.Type]bool)
+	for _, x := range v {
+		rt := reflect.TypeOf(x)
+		for rt != nil && rt.Kind() == reflect.Ptr {
+			rt = rt.Elem()
+		}
+		t.types[rt] = true
+	}
+}
+
+// Count is the number of records added
+func (t *Totals) Count() int {
+	return t.count
+}
+
+// Add adds the numeric fields of the record v, a struct or a pointer to one,
+// to the totals. Fields tagged total are not added, nor are records of other
+// types than those set with SetRecordTypes
+func (t *Totals) Add(v interface{}) (err error) {
+	val, err := structValue(v)
+	if err != nil {
+		return
+	}
+	if t.types != nil && !t.types[val.Type()] {
+		return
+	}
+	var fields []layoutField
+	if fields, err = structLayout(val.Type()); err != nil {
+		return
+	}
+	if t.ints == nil {
+		t.ints = make(map[string]int64)
+		t.floats = make(map[string]float64)
+	}
+	for _, f := range fields {
+		if f.tags == nil || f.tags.Filler || f.tags.Total != "" {
+			continue
+		}
+		fv, ok := fieldByIndex(val, f.field.Index, false)
+		for ok && (fv.Kind() == reflect.Ptr || fv.Kind() == reflect.Interface) {
+			ok = !fv.IsNil()
+			fv = fv.Elem()
+		}
+		if !ok {
+			continue
+		}
+		switch fv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			t.ints[f.field.Name] += fv.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			t.ints[f.field.Name] += int64(fv.Uint())
+		case reflect.Float32, reflect.Float64:
+			t.floats[f.field.Name] += fv.Float()
+		}
+	}
+	t.count += 1
+	return
+}
+
+// Fill sets the total fields of the trailer v points to
+func (t *Totals) Fill(v interface{}) (err error) {
+	val := reflect.ValueOf(v)
+	if val.Kind() != reflect.Ptr || val.IsNil() {
+		return errors.New(fmt.Sprintf("fill totals of %T, expected a pointer to a struct", v))
+	}
+	return t.apply(v, true)
+}
+
+// Verify compares the total fields of the trailer v with the totals, a
+// difference is returned as a *TotalsError
+func (t *Totals) Verify(v interface{}) (err error) {
+	return t.apply(v, false)
+}
+
+func (t *Totals) apply(v interface{}, set bool) (err error) {
+	val, err := structValue(v)
+	if err != nil {
+		return
+	}
+	var fields []layoutField
+	if fields, err = structLayout(val.Type()); err != nil {
+		return
+	}
+	var mismatches []TotalMismatch
+	for _, f := range fields {
+		if f.tags == nil || f.tags.Total == "" {
+			continue
+		}
+		fv, ok := fieldByIndex(val, f.field.Index, set)
+		for ok && fv.Kind() == reflect.Ptr {
+			if fv.IsNil() {
+				if !set {
+					break
+				}
+				fv.Set(reflect.New(fv.Type().Elem()))
+			}
+			fv = fv.Elem()
+		}
+		var want, got string
+		switch fv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			w := t.intTotal(f.tags)
+			if set {
+				if fv.OverflowInt(w) {
+					return errors.New(fmt.Sprintf("total %d overflows field %s", w, f.field.Name))
+				}
+				fv.SetInt(w)
+			}
+			want, got = strconv.FormatInt(w, 10), strconv.FormatInt(fv.Int(), 10)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			w := t.intTotal(f.tags)
+			if w < 0 {
+				return errors.New(fmt.Sprintf("negative total %d for unsigned field %s", w, f.field.Name))
+			}
+			if set {
+				if fv.OverflowUint(uint64(w)) {
+					return errors.New(fmt.Sprintf("total %d overflows field %s", w, f.field.Name))
+				}
+				fv.SetUint(uint64(w))
+			}
+			want, got = strconv.FormatUint(uint64(w), 10), strconv.FormatUint(fv.Uint(), 10)
+		case reflect.Float32, reflect.Float64:
+			w := t.floatTotal(f.tags)
+			if set {
+				fv.SetFloat(w)
+			}
+			want, got = t.formatTotal(w, f.tags), t.formatTotal(fv.Float(), f.tags)
+		default:
+			// a nil pointer
+			want, got = "set", "nil"
+		}
+		if want != got {
+			mismatches = append(mismatches, TotalMismatch{Field: f.field.Name, Total: f.tags.Total, Want: want, Got: got})
+		}
+	}
+	if len(mismatches) > 0 {
+		err = &TotalsError{Struct: val.Type().Name(), Mismatches: mismatches}
+	}
+	return
+}
+
+// intTotal is the total for an integer field, cut to its width when it is
+// tagged overflow:truncate
+func (t *Totals) intTotal(tags *fixedTags) (w int64) {
+	if tags.Total == totalRecords {
+		w = int64(t.count)
+	} else {
+		w = t.ints[tags.Total] + int64(math.Round(t.floats[tags.Total]))
+	}
+	if tags.Overflow == overflowTruncate && tags.Base == 10 && tags.Len < 19 {
+		w %= int64(math.Pow10(tags.Len))
+	}
+	return
+}
+
+func (t *Totals) floatTotal(tags *fixedTags) float64 {
+	if tags.Total == totalRecords {
+		return float64(t.count)
+	}
+	return t.floats[tags.Total] + float64(t.ints[tags.Total])
+}
+
+// formatTotal renders a float total with the decimals of its field, so sums
+// are compared at the precision they are written with
+func (t *Totals) formatTotal(f float64, tags *fixedTags) string {
+	return strconv.FormatFloat(f, 'f', tags.Decimals, 64)
+}
+
+// hasTotals reports whether the struct type of v has total fields, such
+// records are trailers
+func hasTotals(v interface{}) bool {
+	val, err := structValue(v)
+	if err != nil {
+		return false
+	}
+	fields, err := structLayout(val.Type())
+	if err != nil {
+		return false
+	}
+	for _, f := range fields {
+		if f.tags != nil && f.tags.Total != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// structValue dereferences v down to a struct
+func structValue(v interface{}) (val reflect.Value, err error) {
+	val = reflect.ValueOf(v)
+	for val.Kind() == reflect.Ptr && !val.IsNil() {
+		val = val.Elem()
+	}
+	if val.Kind() != reflect.Struct {
+		err = errors.New(fmt.Sprintf("totals of %T, expected a struct", v))
+	}
+	return
+}
@@ -0,0 +1,138 @@
+package fixedwidth
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type totalsDetail struct {
+	Type    string  `fixed:"len:1"`
+	Routing int     `fixed:"len:4"`
+	Amount  float64 `fixed:"len:6,decimals:2,implied:true"`
+}
+
+type totalsTrailer struct {
+	Type   string  `fixed:"len:1"`
+	Count  int     `fixed:"len:3,total:records"`
+	Hash   int     `fixed:"len:4,total:Routing,overflow:truncate"`
+	Amount float64 `fixed:"len:8,decimals:2,implied:true,total:Amount"`
+}
+
+func TestTotalsEncoder(t *testing.T) {
+	data := "D9000001050\nD2000002025\nT002100000003075\n"
+	buf := bytes.Buffer{}
+	enc := NewEncoder(&buf)
+	enc.SetTotals(&Totals{})
+	for _, r := range []interface{}{
+		totalsDetail{"D", 9000, 10.50},
+		totalsDetail{"D", 2000, 20.25},
+		totalsTrailer{Type: "T"},
+	} {
+		if err := enc.Encode(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if buf.String() != data {
+		t.Errorf("Totals encoded incorrectly expected: %q got: %q", data, buf.String())
+	}
+}
+
+func TestTotalsDecoder(t *testing.T) {
+	totals := &Totals{}
+	dec := NewDecoder(strings.NewReader("D9000001050\nD2000002025\nT003100000003070\n"))
+	dec.SetTotals(totals)
+	var d totalsDetail
+	for i := 0; i < 2; i += 1 {
+		if err := dec.Decode(&d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := dec.Decode(&totalsTrailer{})
+	var te *TotalsError
+	if !errors.As(err, &te) {
+		t.Fatal("Expected a *TotalsError got:", err)
+	}
+	if len(te.Mismatches) != 2 || te.Mismatches[0].Field != "Count" || te.Mismatches[0].Want != "2" ||
+		te.Mismatches[1].Field != "Amount" || te.Mismatches[1].Want != "30.75" || te.Mismatches[1].Got != "30.70" {
+		t.Errorf("Totals mismatches incorrectly expected: Count 2 and Amount 30.75 got: %+v", te.Mismatches)
+	}
+
+	ok := totalsTrailer{Count: 2, Hash: 1000, Amount: 30.75}
+	if err := totals.Verify(ok); err != nil {
+		t.Error(err)
+	}
+	totals.Reset()
+	if totals.Count() != 0 {
+		t.Error("Totals reset incorrectly expected count 0 got:", totals.Count())
+	}
+}
+
+type totalsHeader struct {
+	Type    string `fixed:"len:1"`
+	Routing int    `fixed:"len:4"`
+}
+
+func TestTotalsRecordTypes(t *testing.T) {
+	data := "H1234\nD9000001050\nD2000002025\nT002100000003075\n"
+	totals := &Totals{}
+	totals.SetRecordTypes(totalsDetail{})
+	buf := bytes.Buffer{}
+	enc := NewEncoder(&buf)
+	enc.SetTotals(totals)
+	for _, r := range []interface{}{
+		totalsHeader{"H", 1234},
+		totalsDetail{"D", 9000, 10.50},
+		&totalsDetail{"D", 2000, 20.25},
+		totalsTrailer{Type: "T"},
+	} {
+		if err := enc.Encode(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if buf.String() != data {
+		t.Errorf("Totals encoded incorrectly expected: %q got: %q", data, buf.String())
+	}
+
+	totals.Reset()
+	dec := NewDecoder(strings.NewReader(data))
+	dec.SetTotals(totals)
+	if err := dec.Decode(&totalsHeader{}); err != nil {
+		t.Fatal(err)
+	}
+	var d totalsDetail
+	for i := 0; i < 2; i += 1 {
+		if err := dec.Decode(&d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dec.Decode(&totalsTrailer{}); err != nil {
+		t.Error("Totals verified incorrectly with a header:", err)
+	}
+}
+
+func TestTotalsFloatWithoutDecimals(t *testing.T) {
+	type trailer struct {
+		Amount float64 `fixed:"len:8,total:Amount"`
+	}
+	totals := &Totals{}
+	if err := totals.Verify(trailer{12.3}); err == nil {
+		t.Error("Expected error for a float total without a decimals tag")
+	}
+
+	type detail struct {
+		Amount float64 `fixed:"len:5"`
+	}
+	type trailer2 struct {
+		Amount float64 `fixed:"len:8,decimals:2,total:Amount"`
+	}
+	for _, a := range []float64{12.10, 0.20} {
+		if err := totals.Add(detail{a}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := totals.Verify(trailer2{12.30}); err != nil {
+		t.Error("Totals verified incorrectly:", err)
+	}
+}
@@ -1,42 +1,126 @@
 package fixedwidth
 
 import (
+	"bytes"
 	"reflect"
 	"time"
 	"errors"
 	"fmt"
 	"strconv"
 	"strings"
-	"bytes"
 )
 
 type Unmarshaler interface {
 	UnmarshalFixed([]byte) error
 }
 
+// ErrShortRecord is the error of a *FieldError for a field that lies past the
+// end of the record
+var ErrShortRecord = errors.New("record too short")
+
+// errors of strict decoding, reported in a *FieldError
+var (
+	// bytes after the last field of the record
+	ErrTrailingData = errors.New("trailing data after the record")
+	// other characters than the pad in a filler, a gap between positioned
+	// fields or after the fields of a nested struct
+	ErrNotPadded = errors.New("unexpected characters in padding")
+	// control characters, NUL included, in a text field
+	ErrInvalidCharacter = errors.New("invalid character")
+)
+
+// DecodeOptions change how Unmarshal and Decoder treat malformed records
+type DecodeOptions struct {
+	// PadShort reads a record that ends early as if it was padded with
+	// spaces, text editors like to trim them. Fields past the end are left
+	// untouched like blank fields, a dependsOn slice only gets the elements
+	// the record holds
+	PadShort bool
+	// Strict rejects records Unmarshal would otherwise accept, with bytes
+	// past the last field, anything but the pad where there is no field and
+	// control characters in text fields. NUL filled numbers, which are
+	// left untouched otherwise, are rejected too. Custom unmarshalers are
+	// passed the record as is
+	Strict bool
+	// Charset transcodes text fields to UTF-8, []byte fields and packed
+	// numbers are read as they are. Fields with a charset tag use theirs
+	Charset *Charset
+}
+
 func Unmarshal(data []byte, out interface{}) (err error) {
-	_, err = unmarshalRecursive(data, nil, reflect.ValueOf(out))
-	return
+	return UnmarshalWithOptions(data, out, DecodeOptions{})
 }
 
-func unmarshalRecursive(data []byte, field *reflect.StructField, val reflect.Value) (valid bool, err error) {
-	var tagz *fixedTags
-	if field != nil {
-		tagz, err = parseTags(*field, val.Kind())
-		if err != nil {
-			return
-		}
-	}
+// UnmarshalWithOptions is like Unmarshal but with non default options
+func UnmarshalWithOptions(data []byte, out interface{}, opts DecodeOptions) (err error) {
+	_, err = unmarshalRecursive(data, opts, nil, nil, reflect.ValueOf(out))
+	return
+}
 
+// unmarshalRecursive decodes data into val, tagz holds the parsed tags of the
+// struct field val belongs to and is nil for the top level value. valid is
+// false when the field was blank so pointers can be left nil
+func unmarshalRecursive(data []byte, opts DecodeOptions, field *reflect.StructField, tagz *fixedTags, val reflect.Value) (valid bool, err error) {
 	valid = true
+	// a nil interface has no type to decode into
+	if !val.IsValid() {
+		err = &UnsupportedTypeError{}
+		return
+	}
 	//custom unmarshaler
 	if _, ok := val.Interface().(Unmarshaler); ok {
 		if val.IsNil() {
 			val.Set(reflect.New(val.Type().Elem()))
 		}
+		if opts.PadShort {
+			// generated unmarshalers index the record directly
+			if l, lerr := recordLen(val.Type()); lerr == nil && len(data) < l {
+				data = append(data[:len(data):len(data)], bytes.Repeat([]byte{blankByte(charsetOf(opts.Charset, tagz))}, l-len(data))...)
+			}
+		}
+		if u, ok := val.Interface().(CharsetUnmarshaler); ok && charsetOf(opts.Charset, tagz) != nil {
+			err = u.UnmarshalFixedCharset(data, charsetOf(opts.Charset, tagz))
+			return
+		}
 		err = val.Interface().(Unmarshaler).UnmarshalFixed(data)
 		return
 	}
+	// text is parsed in ISO-8859-1, one byte per character
+	if cs := charsetOf(opts.Charset, tagz); cs != nil && textValue(val, tagz) {
+		b := make([]byte, len(data))
+		copy(b, data)
+		cs.decodeLatin1(b)
+		if tagz, err = latin1Tags(tagz); err != nil {
+			return
+		}
+		opts.Charset = nil
+		if val.Kind() == reflect.String {
+			if opts.Strict {
+				if err = checkText(b, tagz); err != nil {
+					return
+				}
+			}
+			var s string
+			s, valid = decodeString(b, tagz)
+			val.SetString(fromLatin1([]byte(s)))
+			return
+		}
+		data = b
+	}
+	// a blank packed number is spaces of the charset
+	if cs := charsetOf(opts.Charset, tagz); cs != nil && tagz != nil && tagz.Encoding == encodingPacked {
+		data = packedBlank(data, cs)
+	}
+	if opts.Strict && tagz != nil {
+		switch val.Kind() {
+		case reflect.String, reflect.Bool, reflect.Float32, reflect.Float64,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if err = checkText(data, tagz); err != nil {
+				return
+			}
+		}
+	}
 	switch val.Kind() {
 	case reflect.Ptr:
 		// To get the actual value of the original we have to call Elem()
@@ -47,7 +131,7 @@ func unmarshalRecursive(data []byte, field *reflect.StructField, val reflect.Val
 		// Check if the pointer is nil
 		if !unwrapped.IsValid() {
 			newInst := reflect.New(val.Type().Elem())
-			if valid, err = unmarshalRecursive(data, field, newInst); err != nil {
+			if valid, err = unmarshalRecursive(data, opts, field, tagz, newInst); err != nil {
 				return
 			} else if valid {
 				val.Set(newInst)
@@ -55,83 +139,383 @@ func unmarshalRecursive(data []byte, field *reflect.StructField, val reflect.Val
 			return
 		}
 
-		return unmarshalRecursive(data, field, unwrapped)
+		return unmarshalRecursive(data, opts, field, tagz, unwrapped)
 	case reflect.Interface:
 		unwrapped := val.Elem()
-		return unmarshalRecursive(data, field, unwrapped)
+		// the defaults of the tags depend on the dynamic type
+		if field != nil && unwrapped.IsValid() {
+			if tagz, err = parseTags(*field, leafKind(unwrapped.Type())); err != nil {
+				return
+			}
+		}
+		return unmarshalRecursive(data, opts, field, tagz, unwrapped)
 	case reflect.Struct:
 		// struct type exceptions
-		if t, ok := val.Interface().(time.Time); ok {
-			if tagz.Format != "" {
-				s := strings.Trim(string(data), tagz.Pad)
-				if len(s) > 0 && s[0] != 0x00 {
-					t, err = time.Parse(tagz.Format, s)
-					if err != nil {
-						return
-					}
-					val.Set(reflect.ValueOf(t))
-				} else {
-					valid = false
+		if _, ok := val.Interface().(time.Time); ok {
+			if opts.Strict {
+				if err = checkText(data, tagz); err != nil {
+					return
 				}
-			} else {
-				err = errors.New("no date format specified")
+			}
+			var t time.Time
+			if t, valid, err = decodeTime(data, tagz); err != nil || !valid {
 				return
 			}
+			val.Set(reflect.ValueOf(t))
 			return
 		}
-		// else walk the fields
-		tipe := reflect.TypeOf(val.Interface())
-		pos := 0
-		for i := 0; i < val.NumField(); i += 1 {
-			field := tipe.Field(i)
-			tagz, err = parseTags(field, field.Type.Kind())
-			if err != nil {
-				return
+		// else walk the fields, a charset tag on the struct is the charset of
+		// its fields
+		opts.Charset = charsetOf(opts.Charset, tagz)
+		var fields []layoutField
+		if fields, err = structLayout(val.Type()); err != nil {
+			return
+		}
+		// pos counts columns, fields measured in characters move the ones
+		// after them along by the extra bytes they take up. end is in bytes
+		pos, extra, end := 0, 0, 0
+		var covered []bool
+		if opts.Strict {
+			covered = make([]bool, len(data))
+		}
+		for k, f := range fields {
+			field := f.field
+			if f.offset() >= 0 {
+				pos = f.offset()
 			}
-			if tagz == nil {
+			at := pos + extra
+			if f.tags != nil && f.tags.Filler {
+				if opts.Strict && at < len(data) {
+					raw := data[at:minInt(at+f.width, len(data))]
+					if !isPadding(raw, padOf(opts, f.tags)) {
+						err = fieldError(ErrNotPadded, val.Type(), field, at, f.width, raw)
+						return
+					}
+					cover(covered, at, f.width)
+				}
+				pos += f.width
+				end = maxInt(end, at+f.width)
 				continue
 			}
-			if _, err = unmarshalRecursive(data[pos:pos+tagz.Len], &field, val.Field(i)); err != nil {
+			fv, _ := fieldByIndex(val, field.Index, true)
+			if f.tags != nil && f.tags.DependsOn != "" {
+				var count int
+				if count, err = dependentCount(val, fields[:k], field.Name, f.tags.DependsOn); err != nil {
+					return
+				}
+				width := count * f.tags.Len
+				if opts.PadShort && at+width > len(data) && f.tags.Len > 0 {
+					// the count comes from the record, only the elements it
+					// holds are read so it can not blow up the allocation
+					count = 0
+					if at < len(data) {
+						count = (len(data) - at + f.tags.Len - 1) / f.tags.Len
+					}
+					width = count * f.tags.Len
+				}
+				var raw []byte
+				if raw, err = fieldData(data, at, width, opts); err != nil {
+					err = fieldError(err, val.Type(), field, at, width, raw)
+					return
+				}
+				if raw != nil {
+					fv.Set(reflect.MakeSlice(field.Type, count, count))
+					if _, err = unmarshalElements(raw, opts, &field, f.tags, fv); err != nil {
+						err = fieldError(err, val.Type(), field, at, width, raw)
+						return
+					}
+				}
+				cover(covered, at, width)
+				pos += width
+				end = maxInt(end, at+width)
+				continue
+			}
+			width := f.width
+			if f.columns {
+				if width, err = fieldSpan(data, at, f, opts); err != nil {
+					err = fieldError(err, val.Type(), field, at, f.width, nil)
+					return
+				}
+				extra += width - f.width
+			}
+			var raw []byte
+			if raw, err = fieldData(data, at, width, opts); err != nil {
+				err = fieldError(err, val.Type(), field, at, width, raw)
 				return
 			}
-			pos += tagz.Len
+			if raw != nil {
+				if _, err = unmarshalRecursive(raw, opts, &field, f.tags, fv); err != nil {
+					err = fieldError(err, val.Type(), field, at, width, raw)
+					return
+				}
+			}
+			cover(covered, at, width)
+			pos += f.width
+			end = maxInt(end, at+width)
+		}
+		if opts.Strict {
+			err = checkRecord(data, covered, end, val.Type(), tagz, opts)
 		}
 	case reflect.String:
-		s := string(data)
-		s = strings.Trim(s, tagz.Pad)
+		var s string
+		s, valid = decodeString(data, tagz)
 		val.SetString(s)
-		if s == "" {
-			valid = false
-		}
 		return
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		if len(data) > 0 && data[0] != 0x00 {
+		if len(data) > 0 && (data[0] != 0x00 || tagz.Encoding == encodingPacked) {
 			var tmpInt int64
-			if tagz.Pad != defaultPadInt {
-				data = bytes.Trim(data, tagz.Pad)
+			if tmpInt, valid, err = decodeInt(data, tagz, val.Type().Bits()); err != nil || !valid {
+				return
 			}
-			if string(data) == "" {
-				valid = false
+			val.SetInt(tmpInt)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if len(data) > 0 && (data[0] != 0x00 || tagz.Encoding == encodingPacked) {
+			var tmpUint uint64
+			if tmpUint, valid, err = decodeUint(data, tagz, val.Type().Bits()); err != nil || !valid {
 				return
 			}
-			tmpInt, err = strconv.ParseInt(string(data), tagz.Base, 64)
-			if err != nil {
-				err = errors.New(fmt.Sprintf("parseInt error for field %s tag %s, %s", field.Name, field.Tag.Get(tagName), err.Error()))
+			val.SetUint(tmpUint)
+		}
+	case reflect.Bool:
+		var b bool
+		if b, valid, err = decodeBool(data, tagz); err != nil || !valid {
+			return
+		}
+		val.SetBool(b)
+		return
+	case reflect.Float32, reflect.Float64:
+		if len(data) > 0 && (data[0] != 0x00 || tagz.Encoding == encodingPacked) {
+			var tmpFloat float64
+			if tmpFloat, valid, err = decodeFloat(data, tagz, val.Type().Bits()); err != nil || !valid {
 				return
 			}
-			val.SetInt(tmpInt)
+			val.SetFloat(tmpFloat)
 		}
 	case reflect.Slice:
 		if _, ok := val.Interface().([]byte); ok {
 			val.SetBytes(data)
 			return
 		}
-		err = errors.New(fmt.Sprintf("Unknown slice type %s", val.Kind()))
+		if tagz.Count == 0 {
+			err = errors.New(fmt.Sprintf("slice field %s requires a count tag", field.Name))
+			return
+		}
+		val.Set(reflect.MakeSlice(val.Type(), tagz.Count, tagz.Count))
+		return unmarshalElements(data, opts, field, tagz, val)
+	case reflect.Array:
+		return unmarshalElements(data, opts, field, tagz, val)
+
+	default:
+		err = &UnsupportedTypeError{Type: val.Type()}
 		return
+	}
+	return
+}
 
+// unmarshalElements decodes consecutive elements of an array or slice, each
+// element is tagz.Len wide and decoded with the tags of the field
+func unmarshalElements(data []byte, opts DecodeOptions, field *reflect.StructField, tagz *fixedTags, val reflect.Value) (valid bool, err error) {
+	valid = true
+	for i := 0; i < val.Len(); i += 1 {
+		var raw []byte
+		if raw, err = fieldData(data, i*tagz.Len, tagz.Len, opts); err != nil {
+			err = elementError(err, i, tagz.Len, raw)
+			return
+		}
+		if raw == nil {
+			continue
+		}
+		if _, err = unmarshalRecursive(raw, opts, field, tagz, val.Index(i)); err != nil {
+			err = elementError(err, i, tagz.Len, raw)
+			return
+		}
+	}
+	return
+}
+
+// cover marks the columns of a field that was read, covered is nil when
+// decoding is not strict
+func cover(covered []bool, pos int, width int) {
+	for i := pos; i < pos+width && i < len(covered); i += 1 {
+		covered[i] = true
+	}
+}
+
+// checkRecord makes sure the columns of a struct no field covered are blank.
+// Gaps between fields have to be spaces, what follows the last field is
+// the padding of a nested struct and not allowed at all for the top level
+func checkRecord(data []byte, covered []bool, end int, t reflect.Type, tagz *fixedTags, opts DecodeOptions) error {
+	blank := blankByte(opts.Charset)
+	for i := 0; i < end && i < len(data); i += 1 {
+		if !covered[i] && data[i] != blank {
+			return &FieldError{Struct: t.Name(), Offset: i, Len: 1, Raw: data[i : i+1], Err: ErrNotPadded}
+		}
+	}
+	if end >= len(data) {
+		return nil
+	}
+	if tagz == nil {
+		return &FieldError{Struct: t.Name(), Offset: end, Len: len(data) - end, Raw: data[end:], Err: ErrTrailingData}
+	}
+	if !isPadding(data[end:], padOf(opts, tagz)) {
+		return &FieldError{Struct: t.Name(), Offset: end, Len: len(data) - end, Raw: data[end:], Err: ErrNotPadded}
+	}
+	return nil
+}
+
+// padOf is the pad of a field as it appears in the record, in the charset of
+// the field
+func padOf(opts DecodeOptions, tagz *fixedTags) string {
+	cs := charsetOf(opts.Charset, tagz)
+	if cs == nil {
+		return tagz.Pad
+	}
+	b, err := cs.Encode(tagz.Pad)
+	if err != nil {
+		return tagz.Pad
+	}
+	return string(b)
+}
+
+// isPadding reports whether b consists of pad characters only
+func isPadding(b []byte, pad string) bool {
+	return strings.Trim(string(b), pad) == ""
+}
+
+// checkText rejects control characters in a text field, packed numbers are
+// binary
+func checkText(data []byte, tagz *fixedTags) error {
+	if tagz.Encoding == encodingPacked {
+		return nil
+	}
+	for _, c := range data {
+		if c < 0x20 || c == 0x7f {
+			return ErrInvalidCharacter
+		}
+	}
+	return nil
+}
+
+// fieldData returns the width bytes of data at pos. A record that ends early
+// is an error and raw holds what there is of the field, unless opts.PadShort
+// is set, then a partial field is padded with spaces and raw is nil for a
+// field that is missing entirely
+func fieldData(data []byte, pos int, width int, opts DecodeOptions) (raw []byte, err error) {
+	if pos+width <= len(data) {
+		raw = data[pos : pos+width]
+		return
+	}
+	if pos >= len(data) {
+		if !opts.PadShort {
+			raw, err = []byte{}, ErrShortRecord
+		}
+		return
+	}
+	raw = data[pos:]
+	if !opts.PadShort {
+		err = ErrShortRecord
+		return
+	}
+	raw = append(raw[:len(raw):len(raw)], bytes.Repeat([]byte{blankByte(opts.Charset)}, pos+width-len(data))...)
+	return
+}
+
+// the decode functions below parse a single column, valid is false when it
+// is blank. They are shared with the Field methods used by generated code
+
+func decodeString(data []byte, tagz *fixedTags) (s string, valid bool) {
+	s = strings.Trim(string(data), tagz.Pad)
+	valid = s != ""
+	return
+}
+
+func decodeInt(data []byte, tagz *fixedTags, bitSize int) (v int64, valid bool, err error) {
+	var sign, digits string
+	if sign, digits, err = decodeNumber(data, tagz); err != nil {
+		return
+	}
+	if sign == "" && digits == "" {
+		return
+	}
+	if v, err = strconv.ParseInt(sign+digits, tagz.Base, 64); err != nil {
+		return
+	}
+	if trunc := (v << uint(64-bitSize)) >> uint(64-bitSize); trunc != v {
+		err = errors.New(fmt.Sprintf("value %d overflows int%d", v, bitSize))
+		return
+	}
+	valid = true
+	return
+}
+
+func decodeUint(data []byte, tagz *fixedTags, bitSize int) (v uint64, valid bool, err error) {
+	var sign, digits string
+	if sign, digits, err = decodeNumber(data, tagz); err != nil {
+		return
+	}
+	if sign == "" && digits == "" {
+		return
+	}
+	if sign == "-" {
+		err = errors.New(fmt.Sprintf("negative value %s for an unsigned field", string(data)))
+		return
+	}
+	if v, err = strconv.ParseUint(digits, tagz.Base, 64); err != nil {
+		return
+	}
+	if trunc := (v << uint(64-bitSize)) >> uint(64-bitSize); trunc != v {
+		err = errors.New(fmt.Sprintf("value %d overflows uint%d", v, bitSize))
+		return
+	}
+	valid = true
+	return
+}
+
+func decodeFloat(data []byte, tagz *fixedTags, bitSize int) (v float64, valid bool, err error) {
+	var sign, digits string
+	if sign, digits, err = decodeNumber(data, tagz); err != nil {
+		return
+	}
+	if sign == "" && digits == "" {
+		return
+	}
+	s := sign + digits
+	if tagz.Implied {
+		s = insertImpliedPoint(s, tagz.Decimals)
+	}
+	if v, err = strconv.ParseFloat(s, bitSize); err != nil {
+		return
+	}
+	valid = true
+	return
+}
+
+func decodeBool(data []byte, tagz *fixedTags) (b bool, valid bool, err error) {
+	s := strings.Trim(string(data), tagz.Pad)
+	switch s {
+	case "", tagz.Unknown:
+	case tagz.True:
+		b, valid = true, true
+	case tagz.False:
+		valid = true
 	default:
-		err = errors.New("Unknown type: " + val.Kind().String())
+		err = errors.New(fmt.Sprintf("invalid bool %s, expected %s or %s", s, tagz.True, tagz.False))
+	}
+	return
+}
+
+func decodeTime(data []byte, tagz *fixedTags) (t time.Time, valid bool, err error) {
+	if tagz.Format == "" {
+		err = errors.New("no date format specified")
 		return
 	}
+	s := strings.Trim(string(data), tagz.Pad)
+	if len(s) > 0 && s[0] != 0x00 {
+		if t, err = time.Parse(tagz.Format, s); err != nil {
+			return
+		}
+		valid = true
+	}
 	return
 }
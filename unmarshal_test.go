@@ -2,10 +2,12 @@ package fixedwidth
 
 import (
 	"testing"
+	"errors"
 	"bytes"
 	"encoding/hex"
 	"time"
 	"strings"
+	"reflect"
 )
 
 func TestUnmarshalIntegerZeroPad(t *testing.T) {
@@ -231,3 +233,506 @@ func TestUnmarshalStringPtr(t *testing.T) {
 		t.Error("String2 decoded incorrectly expected: nil")
 	}
 }
+
+func TestUnmarshalUnsigned(t *testing.T) {
+	data := []byte("18446744073709551615  1200FF")
+	dest := struct {
+		Number1 uint64  `fixed:"len:20"`
+		Number2 *uint32 `fixed:"len:4,pad: "`
+		Number3 uint    `fixed:"len:4,base:16"`
+	}{}
+	err := Unmarshal(data, &dest)
+	if err != nil {
+		t.Error(err)
+	}
+	if dest.Number1 != 18446744073709551615 {
+		t.Error("Number decoded incorrectly expected: 18446744073709551615 got:", dest.Number1)
+	}
+	if dest.Number2 == nil || *dest.Number2 != 12 {
+		t.Error("Number decoded incorrectly expected: 12 got:", dest.Number2)
+	}
+	if dest.Number3 != 255 {
+		t.Error("Number decoded incorrectly expected: 255 got:", dest.Number3)
+	}
+}
+
+func TestUnmarshalOverflow(t *testing.T) {
+	dest1 := struct {
+		Number uint8 `fixed:"len:4"`
+	}{}
+	if err := Unmarshal([]byte("0256"), &dest1); err == nil {
+		t.Error("Expected overflow error for uint8, got:", dest1.Number)
+	}
+	dest2 := struct {
+		Number int8 `fixed:"len:4"`
+	}{}
+	if err := Unmarshal([]byte("-129"), &dest2); err == nil {
+		t.Error("Expected overflow error for int8, got:", dest2.Number)
+	}
+	dest3 := struct {
+		Number uint16 `fixed:"len:4"`
+	}{}
+	if err := Unmarshal([]byte("00-1"), &dest3); err == nil {
+		t.Error("Expected error for negative uint16, got:", dest3.Number)
+	}
+}
+
+func TestUnmarshalFloat(t *testing.T) {
+	data := []byte("0001234.56000123456000005    1.5")
+	dest := struct {
+		Explicit float64  `fixed:"len:10,decimals:2"`
+		Implied  float64  `fixed:"len:9,decimals:2,implied:true"`
+		Small    float32  `fixed:"len:6,decimals:2,implied:true"`
+		Ptr      *float64 `fixed:"len:7,pad: "`
+	}{}
+	err := Unmarshal(data, &dest)
+	if err != nil {
+		t.Error(err)
+	}
+	if dest.Explicit != 1234.56 {
+		t.Error("Float decoded incorrectly expected: 1234.56 got:", dest.Explicit)
+	}
+	if dest.Implied != 1234.56 {
+		t.Error("Float decoded incorrectly expected: 1234.56 got:", dest.Implied)
+	}
+	if dest.Small != 0.05 {
+		t.Error("Float decoded incorrectly expected: 0.05 got:", dest.Small)
+	}
+	if dest.Ptr == nil || *dest.Ptr != 1.5 {
+		t.Error("Float decoded incorrectly expected: 1.5 got:", dest.Ptr)
+	}
+}
+
+func TestUnmarshalSign(t *testing.T) {
+	for _, c := range []struct {
+		tag    string
+		data   string
+		number int
+	}{
+		{"len:5", "-0012", -12},
+		{"len:5,pad: ", "  -12", -12},
+		{"len:5,sign:trailing", "0012-", -12},
+		{"len:5,sign:trailing,pad: ", "  12-", -12},
+		{"len:5,sign:always", "+0012", 12},
+		{"len:5,sign:separate,pad: ", "-  12", -12},
+		{"len:5,sign:separate,pad: ", "+  12", 12},
+	} {
+		dest := struct {
+			Number int
+		}{}
+		field, _ := reflect.TypeOf(dest).FieldByName("Number")
+		field.Tag = reflect.StructTag(`fixed:"` + c.tag + `"`)
+		tagz, err := parseTags(field, reflect.Int)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := unmarshalRecursive([]byte(c.data), DecodeOptions{}, &field, tagz, reflect.ValueOf(&dest.Number).Elem()); err != nil {
+			t.Error(err)
+		}
+		if dest.Number != c.number {
+			t.Errorf("Number '%s' with %s decoded incorrectly expected: %d got: %d", c.data, c.tag, c.number, dest.Number)
+		}
+	}
+
+	dest := struct {
+		Float float64 `fixed:"len:6,decimals:2,implied:true,sign:trailing"`
+		Uint  uint    `fixed:"len:4"`
+	}{}
+	if err := Unmarshal([]byte("01250-+012"), &dest); err != nil {
+		t.Error(err)
+	}
+	if dest.Float != -12.5 || dest.Uint != 12 {
+		t.Error("Numbers decoded incorrectly expected: -12.5 12 got:", dest.Float, dest.Uint)
+	}
+}
+
+func TestUnmarshalZoned(t *testing.T) {
+	data := []byte("000012{00001J00012345}000042       ")
+	dest := struct {
+		Number1 int     `fixed:"len:7,encoding:zoned"`
+		Number2 int64   `fixed:"len:6,encoding:zoned"`
+		Amount  float64 `fixed:"len:9,encoding:zoned,decimals:2"`
+		Plain   uint    `fixed:"len:6,encoding:zoned"`
+		Blank   *int    `fixed:"len:7,encoding:zoned"`
+	}{}
+	err := Unmarshal(data, &dest)
+	if err != nil {
+		t.Error(err)
+	}
+	if dest.Number1 != 120 || dest.Number2 != -11 {
+		t.Error("Zoned decoded incorrectly expected: 120 -11 got:", dest.Number1, dest.Number2)
+	}
+	if dest.Amount != -1234.50 {
+		t.Error("Zoned decoded incorrectly expected: -1234.50 got:", dest.Amount)
+	}
+	if dest.Plain != 42 {
+		t.Error("Zoned decoded incorrectly expected: 42 got:", dest.Plain)
+	}
+	if dest.Blank != nil {
+		t.Error("Zoned decoded incorrectly expected: nil got:", *dest.Blank)
+	}
+}
+
+func TestUnmarshalPacked(t *testing.T) {
+	data := []byte{0x00, 0x12, 0x0C, 0x12, 0x34, 0x5D, 0x00, 0x04, 0x2F, 0x20, 0x20}
+	dest := struct {
+		Number int     `fixed:"len:3,encoding:packed"`
+		Amount float64 `fixed:"len:3,encoding:packed,decimals:2"`
+		Plain  uint16  `fixed:"len:3,encoding:packed"`
+		Blank  *int    `fixed:"len:2,encoding:packed"`
+	}{}
+	err := Unmarshal(data, &dest)
+	if err != nil {
+		t.Error(err)
+	}
+	if dest.Number != 120 || dest.Amount != -123.45 || dest.Plain != 42 {
+		t.Error("Packed decoded incorrectly expected: 120 -123.45 42 got:", dest.Number, dest.Amount, dest.Plain)
+	}
+	if dest.Blank != nil {
+		t.Error("Packed decoded incorrectly expected: nil got:", *dest.Blank)
+	}
+	if err := Unmarshal([]byte{0x1A, 0x2C}, &struct {
+		Number int `fixed:"len:2,encoding:packed"`
+	}{}); err == nil {
+		t.Error("Expected error for invalid packed digit")
+	}
+
+	lowValues := struct {
+		Number *int `fixed:"len:3,encoding:packed"`
+		Amount int  `fixed:"len:2,encoding:packed"`
+	}{Amount: 7}
+	if err := Unmarshal([]byte{0x00, 0x00, 0x00, 0x00, 0x00}, &lowValues); err != nil {
+		t.Fatal(err)
+	}
+	if lowValues.Number != nil || lowValues.Amount != 7 {
+		t.Error("Packed LOW-VALUES decoded incorrectly expected: nil 7 got:", lowValues.Number, lowValues.Amount)
+	}
+}
+
+func TestPackedNilRoundTrip(t *testing.T) {
+	src := struct {
+		Number *int `fixed:"len:3,encoding:packed"`
+	}{}
+	data, err := Marshal(src)
+	if err != nil {
+		t.Error(err)
+	}
+	dest := struct {
+		Number *int `fixed:"len:3,encoding:packed"`
+	}{}
+	if err := Unmarshal(data, &dest); err != nil {
+		t.Error(err)
+	}
+	if dest.Number != nil {
+		t.Error("Packed decoded incorrectly expected: nil got:", *dest.Number)
+	}
+}
+
+func TestUnmarshalBool(t *testing.T) {
+	data := []byte("1N  ?TRUE ")
+	dest := struct {
+		Default bool  `fixed:"len:1"`
+		Custom  *bool `fixed:"len:1,true:Y,false:N"`
+		Blank   *bool `fixed:"len:2"`
+		Unknown *bool `fixed:"len:1,unknown:?"`
+		Word    bool  `fixed:"len:5,true:TRUE,false:FALSE"`
+	}{}
+	err := Unmarshal(data, &dest)
+	if err != nil {
+		t.Error(err)
+	}
+	if !dest.Default || !dest.Word {
+		t.Error("Bool decoded incorrectly expected: true got:", dest.Default, dest.Word)
+	}
+	if dest.Custom == nil || *dest.Custom {
+		t.Error("Bool decoded incorrectly expected: false got:", dest.Custom)
+	}
+	if dest.Blank != nil || dest.Unknown != nil {
+		t.Error("Bool decoded incorrectly expected: nil got:", dest.Blank, dest.Unknown)
+	}
+	if err := Unmarshal([]byte("X"), &struct {
+		Flag bool `fixed:"len:1,true:Y,false:N"`
+	}{}); err == nil {
+		t.Error("Expected error for invalid bool token")
+	}
+}
+
+func TestUnmarshalArray(t *testing.T) {
+	data := []byte("001002003A  B     AA001BB002")
+	dest := struct {
+		Numbers [3]int      `fixed:"len:3"`
+		Strings []*string   `fixed:"len:3,count:3"`
+		Groups  []occursRec `fixed:"len:5,count:2"`
+	}{}
+	err := Unmarshal(data, &dest)
+	if err != nil {
+		t.Error(err)
+	}
+	if dest.Numbers != [3]int{1, 2, 3} {
+		t.Error("Array decoded incorrectly expected: [1 2 3] got:", dest.Numbers)
+	}
+	if len(dest.Strings) != 3 || *dest.Strings[0] != "A" || *dest.Strings[1] != "B" || dest.Strings[2] != nil {
+		t.Error("Slice decoded incorrectly expected: [A B nil] got:", dest.Strings)
+	}
+	if len(dest.Groups) != 2 || dest.Groups[1].Code != "BB" || dest.Groups[1].Amount != 2 {
+		t.Error("Groups decoded incorrectly expected: [{AA 1} {BB 2}] got:", dest.Groups)
+	}
+}
+
+func TestUnmarshalDependsOn(t *testing.T) {
+	data := []byte("03AA001BB002CC003END")
+	dest := struct {
+		ItemCount uint8       `fixed:"len:2"`
+		Items     []occursRec `fixed:"len:5,dependsOn:ItemCount"`
+		Trailer   string      `fixed:"len:3"`
+	}{}
+	err := Unmarshal(data, &dest)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(dest.Items) != 3 || dest.Items[2].Code != "CC" || dest.Items[2].Amount != 3 {
+		t.Error("DependsOn decoded incorrectly expected 3 items got:", dest.Items)
+	}
+	if dest.Trailer != "END" {
+		t.Error("DependsOn decoded incorrectly expected: END got:", dest.Trailer)
+	}
+
+	bad := struct {
+		Items     []occursRec `fixed:"len:5,dependsOn:ItemCount"`
+		ItemCount int         `fixed:"len:2"`
+	}{}
+	if err := Unmarshal([]byte("AA00101"), &bad); err == nil {
+		t.Error("Expected error for counter declared after the slice")
+	}
+}
+
+func TestUnmarshalNested(t *testing.T) {
+	data := []byte("BobMain  00042Elm   00007Oak   00001    X")
+	dest := struct {
+		Name    string        `fixed:"len:3"`
+		Home    nestedAddress `fixed:""`
+		Work    nestedAddress
+		Other   *nestedAddress `fixed:"len:15"`
+		Trailer string         `fixed:"len:1"`
+	}{}
+	err := Unmarshal(data, &dest)
+	if err != nil {
+		t.Error(err)
+	}
+	if dest.Home.Street != "Main" || dest.Home.Zip != 42 {
+		t.Error("Nested decoded incorrectly expected: {Main 42} got:", dest.Home)
+	}
+	if dest.Work.Street != "Elm" || dest.Work.Zip != 7 {
+		t.Error("Nested decoded incorrectly expected: {Elm 7} got:", dest.Work)
+	}
+	if dest.Other == nil || dest.Other.Street != "Oak" || dest.Other.Zip != 1 {
+		t.Error("Nested decoded incorrectly expected: {Oak 1} got:", dest.Other)
+	}
+	if dest.Trailer != "X" {
+		t.Error("Nested decoded incorrectly expected: X got:", dest.Trailer)
+	}
+	if l, err := recordLen(reflect.TypeOf(dest)); err != nil || l != len(data) {
+		t.Error("Nested record length incorrectly expected:", len(data), "got:", l, err)
+	}
+}
+
+func TestUnmarshalNestedArray(t *testing.T) {
+	data := []byte("Main  00042Elm   00007")
+	dest := struct {
+		Addresses [2]nestedAddress `fixed:""`
+	}{}
+	if err := Unmarshal(data, &dest); err != nil {
+		t.Error(err)
+	}
+	if dest.Addresses[1].Street != "Elm" || dest.Addresses[1].Zip != 7 {
+		t.Error("Nested decoded incorrectly expected: {Elm 7} got:", dest.Addresses[1])
+	}
+}
+
+func TestUnmarshalEmbedded(t *testing.T) {
+	data := []byte("D007Bob 42")
+	dest := embeddedRec{}
+	err := Unmarshal(data, &dest)
+	if err != nil {
+		t.Error(err)
+	}
+	if dest.RecordType != "D" || dest.Sequence != 7 || dest.Name != "Bob" || dest.Checksum != 42 {
+		t.Error("Embedded decoded incorrectly expected: {D 7 Bob 42} got:", dest)
+	}
+
+	ptr := struct {
+		*EmbeddedHeader
+		Name string `fixed:"len:4"`
+	}{}
+	if err := Unmarshal(data[:8], &ptr); err != nil {
+		t.Error(err)
+	}
+	if ptr.EmbeddedHeader == nil || ptr.Sequence != 7 || ptr.Name != "Bob" {
+		t.Error("Embedded decoded incorrectly expected: {D 7 Bob} got:", ptr.EmbeddedHeader, ptr.Name)
+	}
+}
+
+func TestUnmarshalPosition(t *testing.T) {
+	data := []byte("H  0042ZZ Bob  XY")
+	dest := struct {
+		Name   string `fixed:"pos:11-15"`
+		Type   string `fixed:"pos:1-1"`
+		Number int    `fixed:"start:4,len:4"`
+		Code   string `fixed:"len:2"`
+		Extra  string `fixed:"start:16,end:17"`
+	}{}
+	err := Unmarshal(data, &dest)
+	if err != nil {
+		t.Error(err)
+	}
+	if dest.Name != "Bob" || dest.Type != "H" || dest.Number != 42 || dest.Code != "ZZ" || dest.Extra != "XY" {
+		t.Error("Position decoded incorrectly expected: {Bob H 42 ZZ XY} got:", dest)
+	}
+	if l, err := recordLen(reflect.TypeOf(dest)); err != nil || l != len(data) {
+		t.Error("Position record length incorrectly expected:", len(data), "got:", l, err)
+	}
+
+	bad := struct {
+		Name string `fixed:"pos:1-5,len:4"`
+	}{}
+	if err := Unmarshal(data, &bad); err == nil {
+		t.Error("Expected error for position not matching len")
+	}
+}
+
+func TestUnmarshalFiller(t *testing.T) {
+	data := []byte("ABxxxCD**0001")
+	dest := struct {
+		First  string `fixed:"len:2"`
+		_      string `fixed:"-,len:3"`
+		Second string `fixed:"len:2"`
+		Skip   string `fixed:"-,len:2"`
+		Number int    `fixed:"len:4"`
+	}{}
+	err := Unmarshal(data, &dest)
+	if err != nil {
+		t.Error(err)
+	}
+	if dest.First != "AB" || dest.Second != "CD" || dest.Skip != "" || dest.Number != 1 {
+		t.Error("Filler decoded incorrectly expected: {AB CD '' 1} got:", dest)
+	}
+}
+
+func TestUnmarshalShortRecord(t *testing.T) {
+	dest := struct {
+		Name   string `fixed:"len:5"`
+		Number int    `fixed:"len:4"`
+		Codes  []int  `fixed:"len:2,count:2"`
+	}{}
+	err := Unmarshal([]byte("Bob  00"), &dest)
+	var fe *FieldError
+	if !errors.As(err, &fe) || !errors.Is(err, ErrShortRecord) {
+		t.Fatal("Expected a *FieldError for ErrShortRecord got:", err)
+	}
+	if fe.Field != "Number" || fe.Offset != 5 || fe.Len != 4 || string(fe.Raw) != "00" {
+		t.Error("Short record error incorrectly expected: Number 5 4 00 got:", fe.Field, fe.Offset, fe.Len, string(fe.Raw))
+	}
+
+	err = UnmarshalWithOptions([]byte("Bob  004201"), &dest, DecodeOptions{PadShort: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dest.Name != "Bob" || dest.Number != 42 || len(dest.Codes) != 2 || dest.Codes[0] != 1 || dest.Codes[1] != 0 {
+		t.Error("Short record decoded incorrectly expected: {Bob 42 [1 0]} got:", dest)
+	}
+
+	// a counter past the end of the record does not size the slice
+	dep := struct {
+		N     int      `fixed:"len:7"`
+		Items []string `fixed:"len:100,dependsOn:N"`
+	}{}
+	if err = UnmarshalWithOptions([]byte("9999999x"), &dep, DecodeOptions{PadShort: true}); err != nil {
+		t.Fatal(err)
+	}
+	if dep.N != 9999999 || len(dep.Items) != 1 || dep.Items[0] != "x" {
+		t.Error("Short record decoded incorrectly expected: 9999999 [x] got:", dep.N, dep.Items)
+	}
+}
+
+func TestUnmarshalMalformedTags(t *testing.T) {
+	cases := []interface{}{
+		&struct {
+			Name string `fixed:"len"`
+		}{},
+		&struct {
+			Name string `fixed:"len:abc"`
+		}{},
+		&struct {
+			Name int `fixed:"len:4,base:99"`
+		}{},
+		&struct {
+			Name string `fixed:"-"`
+		}{},
+		&struct {
+			Name string `fixed:"len:3,pad:"`
+		}{},
+		&struct {
+			Name string `fixed:"len:3,align:center"`
+			Code string `fixed:"len:1"`
+		}{},
+	}
+	for _, c := range cases {
+		if err := Unmarshal([]byte("0001"), c); err == nil {
+			t.Errorf("Expected error for malformed tag on %T", c)
+		}
+		if _, err := Marshal(c); err == nil {
+			t.Errorf("Expected error marshaling malformed tag on %T", c)
+		}
+	}
+}
+
+func TestUnmarshalStrict(t *testing.T) {
+	type strictRec struct {
+		Name   string        `fixed:"len:4"`
+		_      string        `fixed:"-,len:2"`
+		Number int           `fixed:"len:3"`
+		Addr   nestedAddress `fixed:"len:13"`
+		Code   string        `fixed:"pos:27-28"`
+	}
+	cases := []struct {
+		data string
+		err  error
+	}{
+		{"Bob   042Main  00042      XY", nil},
+		{"Bob   042Main  00042      XYZ", ErrTrailingData},
+		{"Bob **042Main  00042      XY", ErrNotPadded},
+		{"Bob   042Main  00042*     XY", ErrNotPadded},
+		{"Bob   042Main  00042   *  XY", ErrNotPadded},
+		{"Bob   \x00\x00\x00Main  00042      XY", ErrInvalidCharacter},
+		{"Bo\tb  042Main  00042      XY", ErrInvalidCharacter},
+	}
+	for _, c := range cases {
+		var dest strictRec
+		if err := Unmarshal([]byte(c.data), &dest); err != nil {
+			t.Errorf("Lenient decoding of %q failed: %v", c.data, err)
+		}
+		err := UnmarshalWithOptions([]byte(c.data), &dest, DecodeOptions{Strict: true})
+		if c.err == nil && err != nil {
+			t.Errorf("Strict decoding of %q failed: %v", c.data, err)
+		}
+		var fe *FieldError
+		if c.err != nil && (!errors.Is(err, c.err) || !errors.As(err, &fe)) {
+			t.Errorf("Strict decoding of %q expected: %v got: %v", c.data, c.err, err)
+		}
+	}
+}
+
+func TestUnmarshalNilInterface(t *testing.T) {
+	if err := Unmarshal([]byte("ab"), nil); err == nil {
+		t.Error("Expected error unmarshaling into nil")
+	}
+	dest := struct {
+		A string      `fixed:"len:2"`
+		V interface{} `fixed:"len:3"`
+	}{}
+	err := Unmarshal([]byte("ab123"), &dest)
+	var ute *UnsupportedTypeError
+	if !errors.As(err, &ute) {
+		t.Error("Expected an *UnsupportedTypeError got:", err)
+	}
+}
@@ -4,53 +4,418 @@ import (
 	"strings"
 	"reflect"
 	"strconv"
+	"errors"
+	"fmt"
 )
 
 type fixedTags struct {
-	Len    int
-	Pad    string
-	Format string
-	Base   int
-	Align  string
+	Len       int
+	Pad       string
+	Format    string
+	Base      int
+	Align     string
+	Decimals  int
+	Implied   bool
+	Sign      string
+	Encoding  string
+	True      string
+	False     string
+	Unknown   string
+	Count     int
+	DependsOn string
+	// what to do with a value wider than the field, error or truncate
+	Overflow string
+	// the field of the records a trailer field holds the sum of, or records
+	// for their number
+	Total string
+	// name of the charset of the field, overriding the one of the Encoder or
+	// Decoder
+	Charset string
+	// how len is counted for strings, bytes, runes or display columns
+	Width string
+	// reserved columns that are written blank and skipped when reading
+	Filler bool
+	// zero based start of the field in its struct, -1 when it directly
+	// follows the previous field
+	Offset int
+}
+
+// width is the number of bytes the field takes up in a record, for arrays
+// and counted slices len is the width of a single element
+func (f *fixedTags) width() int {
+	if f.Count > 0 {
+		return f.Len * f.Count
+	}
+	return f.Len
 }
 
 func parseTags(field reflect.StructField, kind reflect.Kind) (f *fixedTags, err error) {
 	tags := make(map[string]string)
-	tag := field.Tag.Get(tagName)
-	if tag == "" {
+	tag, ok := field.Tag.Lookup(tagName)
+	if !ok {
 		return
 	}
 	var rawTags = strings.Split(tag, ",")
 
-	for _, rt := range rawTags {
-		x := strings.Split(rt, ":")
+	f = new(fixedTags)
+	for i, rt := range rawTags {
+		if rt == "" {
+			continue
+		}
+		if i == 0 && rt == tagFiller {
+			f.Filler = true
+			continue
+		}
+		x := strings.SplitN(rt, ":", 2)
+		if len(x) != 2 {
+			err = errors.New(fmt.Sprintf("invalid tag %s on field %s, expected key:value", rt, field.Name))
+			return
+		}
 		tags[x[0]] = x[1]
 	}
-	f = new(fixedTags)
-	if f.Len, err = strconv.Atoi(tags[tagLen]); err != nil {
+	f.Base = 10
+	if f.Base, err = tagInt(tags, tagBase, f.Base, field); err != nil {
 		return
 	}
-	f.Base = 10
-	if b, ok := tags[tagBase]; ok {
-		if f.Base, err = strconv.Atoi(b); err != nil {
+	if f.Base < 2 || f.Base > 36 {
+		err = errors.New(fmt.Sprintf("invalid base %d on field %s", f.Base, field.Name))
+		return
+	}
+	if f.Decimals, err = tagInt(tags, tagDecimals, -1, field); err != nil {
+		return
+	}
+	if i, ok := tags[tagImplied]; ok {
+		if f.Implied, err = strconv.ParseBool(i); err != nil {
+			err = errors.New(fmt.Sprintf("invalid implied tag %s on field %s", i, field.Name))
+			return
+		}
+		if f.Implied && f.Decimals < 0 {
+			err = errors.New(fmt.Sprintf("implied decimal point requires a decimals tag on field %s", field.Name))
+			return
+		}
+	}
+	f.Sign = signLeading
+	if t, ok := tags[tagSign]; ok {
+		switch t {
+		case signLeading, signTrailing, signAlways, signSeparate:
+			f.Sign = t
+		default:
+			err = errors.New(fmt.Sprintf("unknown sign mode %s on field %s", t, field.Name))
+			return
+		}
+	}
+	f.Encoding = encodingText
+	if e, ok := tags[tagEncoding]; ok {
+		switch e {
+		case encodingText:
+		case encodingZoned, encodingPacked:
+			if f.Base != 10 {
+				err = errors.New(fmt.Sprintf("%s encoding requires base 10 on field %s", e, field.Name))
+				return
+			}
+			// zoned and packed numbers never carry a decimal point
+			if kind == reflect.Float32 || kind == reflect.Float64 {
+				if f.Decimals < 0 {
+					err = errors.New(fmt.Sprintf("%s encoding of a float requires a decimals tag on field %s", e, field.Name))
+					return
+				}
+				f.Implied = true
+			}
+		default:
+			err = errors.New(fmt.Sprintf("unknown encoding %s on field %s", e, field.Name))
 			return
 		}
+		f.Encoding = e
 	}
 	switch kind {
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
 		f.Pad = defaultPadInt
 		f.Align = alignRight
 	default:
 		f.Align = alignLeft
 		f.Pad = defaultPadString
 	}
+	// a number or date cut short is a different value, text is merely shorter
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.Struct:
+		f.Overflow = overflowError
+	default:
+		f.Overflow = overflowTruncate
+	}
+	if o, ok := tags[tagOverflow]; ok {
+		if o != overflowError && o != overflowTruncate {
+			err = errors.New(fmt.Sprintf("unknown overflow mode %s on field %s", o, field.Name))
+			return
+		}
+		f.Overflow = o
+	}
+	// a blank packed field is spaces, zero digits would be invalid nibbles
+	if f.Encoding == encodingPacked {
+		f.Pad = defaultPadString
+	}
+	// fillers are blank whatever the type of their field
+	if f.Filler {
+		f.Pad = defaultPadString
+	}
 	if t, ok := tags[tagPad]; ok {
+		if t == "" {
+			err = errors.New(fmt.Sprintf("empty pad tag on field %s", field.Name))
+			return
+		}
 		f.Pad = t
 	}
 	f.Format = tags[tagFormat]
+	f.True = defaultTrue
+	if t, ok := tags[tagTrue]; ok {
+		f.True = t
+	}
+	f.False = defaultFalse
+	if t, ok := tags[tagFalse]; ok {
+		f.False = t
+	}
+	f.Unknown = tags[tagUnknown]
+	f.Charset = tags[tagCharset]
+	if _, ok := charsets[f.Charset]; f.Charset != "" && !ok {
+		err = errors.New(fmt.Sprintf("unknown charset %s on field %s", f.Charset, field.Name))
+		return
+	}
+	f.Width = widthBytes
+	if w, ok := tags[tagWidth]; ok {
+		switch w {
+		case widthBytes, widthRunes, widthDisplay:
+			f.Width = w
+		default:
+			err = errors.New(fmt.Sprintf("unknown width %s on field %s", w, field.Name))
+			return
+		}
+	}
+	f.Total = tags[tagTotal]
+	if f.Total != "" && !isNumber(kind) {
+		err = errors.New(fmt.Sprintf("total tag requires a number on field %s", field.Name))
+		return
+	}
+	// float sums are compared at the precision they are written with
+	if f.Total != "" && (kind == reflect.Float32 || kind == reflect.Float64) && f.Decimals < 0 {
+		err = errors.New(fmt.Sprintf("total tag on a float requires a decimals tag on field %s", field.Name))
+		return
+	}
+	ft := field.Type
+	for ft.Kind() == reflect.Ptr {
+		ft = ft.Elem()
+	}
+	f.DependsOn = tags[tagDependsOn]
+	if f.DependsOn != "" && ft.Kind() != reflect.Slice {
+		err = errors.New(fmt.Sprintf("dependsOn tag requires a slice on field %s", field.Name))
+		return
+	}
+	if ft.Kind() == reflect.Array {
+		f.Count = ft.Len()
+	} else if ft.Kind() == reflect.Slice && ft.Elem().Kind() != reflect.Uint8 {
+		if f.Count, err = tagInt(tags, tagCount, 0, field); err != nil {
+			return
+		}
+	}
+	if f.Width != widthBytes && (kind != reflect.String || f.Count > 0 || f.DependsOn != "") {
+		err = errors.New(fmt.Sprintf("width:%s requires a string on field %s", f.Width, field.Name))
+		return
+	}
 	if t, ok := tags[tagAlign]; ok {
+		if t != alignLeft && t != alignRight {
+			err = errors.New(fmt.Sprintf("unknown align %s on field %s", t, field.Name))
+			return
+		}
 		f.Align = t
 	}
+	var start, end int
+	if start, end, err = parsePosition(tags, field); err != nil {
+		return
+	}
+	_, hasLen := tags[tagLen]
+	if hasLen {
+		if f.Len, err = tagInt(tags, tagLen, 0, field); err != nil {
+			return
+		}
+	} else if start > 0 && end > 0 {
+		count := 1
+		if f.Count > 0 {
+			count = f.Count
+		}
+		f.Len = (end - start + 1) / count
+	} else if st := inlineStruct(field.Type); st != nil {
+		if f.Len, err = recordLen(st); err != nil {
+			return
+		}
+	} else {
+		err = errors.New(fmt.Sprintf("missing len tag on field %s", field.Name))
+		return
+	}
+	f.Offset = -1
+	if start > 0 {
+		f.Offset = start - 1
+		if end > 0 && end-start+1 != f.width() {
+			err = errors.New(fmt.Sprintf("position %d-%d does not match the width %d of field %s", start, end, f.width(), field.Name))
+			return
+		}
+	}
+	return
+}
+
+// tagInt parses the non negative integer tag key, def when it is not set
+func tagInt(tags map[string]string, key string, def int, field reflect.StructField) (i int, err error) {
+	s, ok := tags[key]
+	if !ok {
+		return def, nil
+	}
+	if i, err = strconv.Atoi(s); err != nil || i < 0 {
+		err = errors.New(fmt.Sprintf("invalid %s tag %s on field %s", key, s, field.Name))
+	}
+	return
+}
+
+func isNumber(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// parsePosition reads the 1 based inclusive column range of a field from
+// either a pos:15-22 tag or start:15 and end:22 tags, end is optional when
+// the field has a len
+func parsePosition(tags map[string]string, field reflect.StructField) (start int, end int, err error) {
+	s, e := tags[tagStart], tags[tagEnd]
+	if p, ok := tags[tagPos]; ok {
+		x := strings.Split(p, "-")
+		if len(x) != 2 {
+			err = errors.New(fmt.Sprintf("invalid position %s on field %s, expected start-end", p, field.Name))
+			return
+		}
+		s, e = x[0], x[1]
+	}
+	if s == "" {
+		if e != "" {
+			err = errors.New(fmt.Sprintf("end position without a start on field %s", field.Name))
+		}
+		return
+	}
+	if start, err = strconv.Atoi(s); err != nil {
+		err = errors.New(fmt.Sprintf("invalid start position %s on field %s", s, field.Name))
+		return
+	}
+	if e != "" {
+		if end, err = strconv.Atoi(e); err != nil {
+			err = errors.New(fmt.Sprintf("invalid end position %s on field %s", e, field.Name))
+			return
+		}
+	}
+	if start < 1 || (end > 0 && end < start) {
+		err = errors.New(fmt.Sprintf("invalid position %d-%d on field %s", start, end, field.Name))
+	}
+	return
+}
+
+// checkOverflow returns an *OverflowError when a value that takes width
+// columns does not fit in l and the field does not allow truncation
+func checkOverflow(value string, width int, l int, tag *fixedTags) error {
+	if width > l && tag.Overflow == overflowError {
+		return &OverflowError{Value: value, Len: l}
+	}
+	return nil
+}
+
+// formatFloat renders f with the tagged number of decimals, dropping the
+// decimal point when it is implied
+func formatFloat(f float64, bitSize int, tag *fixedTags) string {
+	s := strconv.FormatFloat(f, 'f', tag.Decimals, bitSize)
+	if tag.Implied {
+		s = strings.Replace(s, ".", "", 1)
+	}
+	return s
+}
+
+// insertImpliedPoint puts the decimal point back into a number that was
+// written with an implied one, "12345" with 2 decimals becomes "123.45"
+func insertImpliedPoint(s string, decimals int) string {
+	if decimals <= 0 {
+		return s
+	}
+	var sign string
+	if len(s) > 0 && (s[0] == '-' || s[0] == '+') {
+		sign, s = s[:1], s[1:]
+	}
+	if len(s) <= decimals {
+		s = strings.Repeat("0", decimals-len(s)+1) + s
+	}
+	return sign + s[:len(s)-decimals] + "." + s[len(s)-decimals:]
+}
+
+// signAndPad2Len pads a formatted number to the field length and places its
+// sign according to the sign tag. The sign is kept next to the digits unless
+// the number is zero padded or the sign is separate, then it takes the
+// outermost column so "-12" becomes "-0012" rather than "00-12"
+func signAndPad2Len(s string, tag *fixedTags) []byte {
+	var sign string
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	} else if tag.Sign == signAlways || tag.Sign == signSeparate {
+		sign = "+"
+	}
+	if sign == "" {
+		return alignAndPad2Len(tag.Align, s, tag.Pad, tag.Len)
+	}
+	edge := tag.Sign == signSeparate || (tag.Pad == defaultPadInt && tag.Align == alignRight)
+	if tag.Sign == signTrailing {
+		if edge {
+			return append(alignAndPad2Len(tag.Align, s, tag.Pad, tag.Len-1), sign...)
+		}
+		return alignAndPad2Len(tag.Align, s+sign, tag.Pad, tag.Len)
+	}
+	if edge {
+		return append([]byte(sign), alignAndPad2Len(tag.Align, s, tag.Pad, tag.Len-1)...)
+	}
+	return alignAndPad2Len(tag.Align, sign+s, tag.Pad, tag.Len)
+}
+
+// splitSign strips the padding from a number and splits off a leading or
+// trailing sign, "  12-" becomes "-" and "12"
+func splitSign(s string, padStr string) (sign string, digits string) {
+	// a field of spaces is blank whatever the pad
+	if strings.TrimLeft(s, " ") == "" {
+		return
+	}
+	if padStr != defaultPadInt {
+		s = strings.Trim(s, padStr)
+	}
+	if len(s) > 0 && (s[0] == '-' || s[0] == '+') {
+		sign, s = s[:1], s[1:]
+	} else if len(s) > 0 && (s[len(s)-1] == '-' || s[len(s)-1] == '+') {
+		sign, s = s[len(s)-1:], s[:len(s)-1]
+	}
+	if padStr != defaultPadInt {
+		s = strings.Trim(s, padStr)
+	}
+	digits = s
 	return
 }
 
@@ -0,0 +1,218 @@
+package fixedwidth
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// the width tag tells how the len of a string field is counted, in bytes by
+// default, in characters with width:runes or in terminal columns with
+// width:display where East Asian wide characters take up 2 and combining
+// marks none. A field measured in characters takes up as many bytes as its
+// UTF-8 encoding, the fields after it move along
+
+// runeColumns is the number of columns r takes up in mode
+func runeColumns(r rune, mode string) int {
+	if mode != widthDisplay {
+		return 1
+	}
+	if unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf) {
+		return 0
+	}
+	if isWide(r) {
+		return 2
+	}
+	return 1
+}
+
+// textWidth is the number of columns s takes up in mode, invalid UTF-8
+// counts a column per byte
+func textWidth(s string, mode string) (w int) {
+	for _, r := range s {
+		w += runeColumns(r, mode)
+	}
+	return
+}
+
+// padColumns pads or truncates s to l columns without splitting a
+// character, a right aligned field keeps the end of s. A wide character
+// that does not fit is replaced by padding
+func padColumns(align string, s string, padStr string, l int, mode string) []byte {
+	w := 0
+	if align == alignRight {
+		j := len(s)
+		for j > 0 {
+			r, size := utf8.DecodeLastRuneInString(s[:j])
+			if size == 0 || w+runeColumns(r, mode) > l {
+				break
+			}
+			w += runeColumns(r, mode)
+			j -= size
+		}
+		return []byte(padText(padStr, l-w, mode) + s[j:])
+	}
+	i := 0
+	for i < len(s) {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if w+runeColumns(r, mode) > l {
+			break
+		}
+		w += runeColumns(r, mode)
+		i += size
+	}
+	return []byte(s[:i] + padText(padStr, l-w, mode))
+}
+
+// padText repeats padStr over n columns
+func padText(padStr string, n int, mode string) string {
+	if n <= 0 || padStr == "" {
+		return ""
+	}
+	b := strings.Builder{}
+	w := 0
+	for w < n {
+		for _, r := range padStr {
+			c := runeColumns(r, mode)
+			if c == 0 || w+c > n {
+				// a pad that does not fit the remaining columns
+				r, c = ' ', 1
+			}
+			b.WriteRune(r)
+			w += c
+			if w >= n {
+				break
+			}
+		}
+	}
+	return b.String()
+}
+
+// columnSpan is the number of bytes at the start of data holding l columns.
+// When data ends early the missing columns count a byte each, so the field
+// is short like any other
+func columnSpan(data []byte, l int, mode string) (n int) {
+	w := 0
+	for n < len(data) {
+		r, size := utf8.DecodeRune(data[n:])
+		if w+runeColumns(r, mode) > l {
+			return
+		}
+		w += runeColumns(r, mode)
+		n += size
+	}
+	return n + l - w
+}
+
+// fieldSpan is the number of bytes of data at pos holding the field f that is
+// measured in characters, a string or a nested struct with such strings.
+// Text in a single byte charset takes up a byte per character anyway
+func fieldSpan(data []byte, pos int, f layoutField, opts DecodeOptions) (n int, err error) {
+	data = data[minInt(pos, len(data)):]
+	if f.tags != nil && f.tags.Width != widthBytes {
+		if charsetOf(opts.Charset, f.tags) != nil {
+			return f.width, nil
+		}
+		return columnSpan(data, f.width, f.tags.Width), nil
+	}
+	var extra, end int
+	if extra, end, err = structSpan(data, f.field.Type, f.tags, opts); err != nil {
+		return
+	}
+	if f.tags != nil {
+		// padded to its len tag
+		return f.width + extra, nil
+	}
+	return end, nil
+}
+
+// structSpan measures the nested struct of type t at the start of data, extra
+// is the number of bytes its characters take up beyond their columns and end
+// where its last field ends
+func structSpan(data []byte, t reflect.Type, tagz *fixedTags, opts DecodeOptions) (extra int, end int, err error) {
+	var fields []layoutField
+	if fields, err = structLayout(inlineStruct(t)); err != nil {
+		return
+	}
+	opts.Charset = charsetOf(opts.Charset, tagz)
+	pos := 0
+	for _, f := range fields {
+		if f.tags != nil && f.tags.DependsOn != "" {
+			err = errors.New(fmt.Sprintf("width of %s is variable, field %s depends on %s", t, f.field.Name, f.tags.DependsOn))
+			return
+		}
+		if f.offset() >= 0 {
+			pos = f.offset()
+		}
+		n := f.width
+		if f.columns {
+			if n, err = fieldSpan(data, pos+extra, f, opts); err != nil {
+				return
+			}
+		}
+		end = maxInt(end, pos+extra+n)
+		extra += n - f.width
+		pos += f.width
+	}
+	return
+}
+
+// hasColumns reports whether a struct type has fields measured in characters
+func hasColumns(t reflect.Type) bool {
+	return columnsIn(t, nil)
+}
+
+// columnsIn is hasColumns while building the layouts of the types in
+// building. A type that refers to itself, through a pointer, is still being
+// built and counts as measured in bytes
+func columnsIn(t reflect.Type, building []reflect.Type) bool {
+	st := inlineStruct(t)
+	if st == nil {
+		return false
+	}
+	for _, b := range building {
+		if b == st {
+			return false
+		}
+	}
+	fields, err := layoutOf(st, building)
+	if err != nil {
+		return false
+	}
+	for _, f := range fields {
+		if f.columns {
+			return true
+		}
+	}
+	return false
+}
+
+// wideRanges are the East Asian wide and fullwidth blocks and the emoji
+// terminals render 2 columns wide, sorted
+var wideRanges = [][2]rune{
+	{0x1100, 0x115F}, {0x231A, 0x231B}, {0x2329, 0x232A}, {0x23E9, 0x23EC},
+	{0x23F0, 0x23F0}, {0x23F3, 0x23F3}, {0x25FD, 0x25FE}, {0x2614, 0x2615},
+	{0x2648, 0x2653}, {0x267F, 0x267F}, {0x2693, 0x2693}, {0x26A1, 0x26A1},
+	{0x26AA, 0x26AB}, {0x26BD, 0x26BE}, {0x26C4, 0x26C5}, {0x26CE, 0x26CE},
+	{0x26D4, 0x26D4}, {0x26EA, 0x26EA}, {0x26F2, 0x26F3}, {0x26F5, 0x26F5},
+	{0x26FA, 0x26FA}, {0x26FD, 0x26FD}, {0x2705, 0x2705}, {0x270A, 0x270B},
+	{0x2728, 0x2728}, {0x274C, 0x274C}, {0x274E, 0x274E}, {0x2753, 0x2755},
+	{0x2757, 0x2757}, {0x2795, 0x2797}, {0x27B0, 0x27B0}, {0x27BF, 0x27BF},
+	{0x2B1B, 0x2B1C}, {0x2B50, 0x2B50}, {0x2B55, 0x2B55}, {0x2E80, 0x303E},
+	{0x3041, 0x33FF}, {0x3400, 0x4DBF}, {0x4E00, 0x9FFF}, {0xA000, 0xA4CF},
+	{0xA960, 0xA97F}, {0xAC00, 0xD7A3}, {0xF900, 0xFAFF}, {0xFE10, 0xFE19},
+	{0xFE30, 0xFE6F}, {0xFF00, 0xFF60}, {0xFFE0, 0xFFE6}, {0x16FE0, 0x16FE4},
+	{0x17000, 0x18AFF}, {0x1B000, 0x1B2FF}, {0x1F004, 0x1F004}, {0x1F0CF, 0x1F0CF},
+	{0x1F18E, 0x1F18E}, {0x1F191, 0x1F19A}, {0x1F200, 0x1F251}, {0x1F300, 0x1F64F},
+	{0x1F680, 0x1F6FF}, {0x1F900, 0x1F9FF}, {0x1FA70, 0x1FAFF}, {0x20000, 0x2FFFD},
+	{0x30000, 0x3FFFD},
+}
+
+func isWide(r rune) bool {
+	i := sort.Search(len(wideRanges), func(i int) bool { return wideRanges[i][1] >= r })
+	return i < len(wideRanges) && wideRanges[i][0] <= r
+}
@@ -0,0 +1,110 @@
+package fixedwidth
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+type runesRec struct {
+	Name string `fixed:"len:5,width:runes"`
+	Code string `fixed:"len:3"`
+}
+
+type displayRec struct {
+	Name string `fixed:"len:5,width:display"`
+	City string `fixed:"pos:6-9,width:runes,align:right"`
+	Code string `fixed:"pos:10-11"`
+}
+
+type nestedRunesRec struct {
+	Person runesRec
+	Age    int `fixed:"len:2"`
+}
+
+func TestMarshalRunes(t *testing.T) {
+	tests := []struct {
+		in  interface{}
+		out string
+	}{
+		{runesRec{"Renée", "ABC"}, "RenéeABC"},
+		{runesRec{"Zoë", "X"}, "Zoë  X  "},
+		// truncated on a rune boundary
+		{runesRec{"éééééé", "ABC"}, "éééééABC"},
+		// the wide 語 does not fit the last column
+		{displayRec{"日本語", "Köln", "DE"}, "日本 KölnDE"},
+		// right aligned fields keep the end
+		{displayRec{"éa", "Bühlerhöhe", "DE"}, "éa   höheDE"},
+		{nestedRunesRec{runesRec{"Zoë", "X"}, 7}, "Zoë  X  07"},
+	}
+	for _, test := range tests {
+		b, err := Marshal(test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != test.out {
+			t.Errorf("%T encoded incorrectly expected: %q got: %q", test.in, test.out, b)
+		}
+		if !utf8.Valid(b) {
+			t.Errorf("%T encoded to invalid UTF-8 %q", test.in, b)
+		}
+	}
+}
+
+func TestUnmarshalRunes(t *testing.T) {
+	var r runesRec
+	if err := UnmarshalWithOptions([]byte("RenéeABC"), &r, DecodeOptions{Strict: true}); err != nil {
+		t.Fatal(err)
+	}
+	if r.Name != "Renée" || r.Code != "ABC" {
+		t.Error("runesRec decoded incorrectly expected: {Renée ABC} got:", r)
+	}
+
+	var d displayRec
+	if err := UnmarshalWithOptions([]byte("日本 KölnDE"), &d, DecodeOptions{Strict: true}); err != nil {
+		t.Fatal(err)
+	}
+	if d.Name != "日本" || d.City != "Köln" || d.Code != "DE" {
+		t.Error("displayRec decoded incorrectly expected: {日本 Köln DE} got:", d)
+	}
+
+	var n nestedRunesRec
+	if err := UnmarshalWithOptions([]byte("Zoë  X  07"), &n, DecodeOptions{Strict: true}); err != nil {
+		t.Fatal(err)
+	}
+	if n.Person.Name != "Zoë" || n.Person.Code != "X" || n.Age != 7 {
+		t.Error("nestedRunesRec decoded incorrectly expected: {{Zoë X} 7} got:", n)
+	}
+
+	// a short record with PadShort
+	var s runesRec
+	if err := UnmarshalWithOptions([]byte("Zoë"), &s, DecodeOptions{PadShort: true}); err != nil {
+		t.Fatal(err)
+	}
+	if s.Name != "Zoë" || s.Code != "" {
+		t.Error("runesRec decoded incorrectly expected: {Zoë } got:", s)
+	}
+}
+
+func TestRunesOverflow(t *testing.T) {
+	type rec struct {
+		Name string `fixed:"len:3,width:runes,overflow:error"`
+	}
+	if _, err := Marshal(rec{"été"}); err != nil {
+		t.Error("unexpected error for 3 runes in 3 columns:", err)
+	}
+	if _, err := Marshal(rec{"éték"}); err == nil {
+		t.Error("expected an overflow error for 4 runes in 3 columns")
+	}
+}
+
+func TestRunesInvalidTag(t *testing.T) {
+	type rec struct {
+		Count int `fixed:"len:3,width:runes"`
+	}
+	if _, err := Marshal(rec{1}); err == nil {
+		t.Error("expected an error for width:runes on an int")
+	}
+	if _, err := NewLayout(runesRec{}); err == nil {
+		t.Error("expected an error for the layout of a record measured in characters")
+	}
+}